@@ -11,6 +11,9 @@ type (
 		Env          string
 		ConfigPath   string
 		ConfigPrefix string
+		Network      string
+		Command      string   // Command instead of running service, like migrate
+		CommandArgs  []string // Arguments of command
 	}
 )
 
@@ -19,10 +22,13 @@ const (
 	EnvDev = "dev"
 	// EnvProd argument value for production environment
 	EnvProd = "prod"
+	// CommandMigrate applies or reverts migrations of storage schema and exits
+	CommandMigrate = "migrate"
 
 	configPathFlag   = "cp"
 	configPrefixFlag = "cn"
 	envFlag          = "e"
+	networkFlag      = "n"
 
 	defaultConfigPath   = "./config"
 	defaultConfigPrefix = "config"
@@ -36,11 +42,17 @@ func New() *Args {
 
 // Init flags and parsing them
 func (a *Args) Init() {
-	a.ConfigPath = *flag.String(configPathFlag, defaultConfigPath, "Path to folder with config")
-	a.ConfigPrefix = *flag.String(configPrefixFlag, defaultConfigPrefix, "Prefix of config filename")
-	a.Env = *flag.String(envFlag, defaultEnv, fmt.Sprintf("Environment alias: %s or %s", EnvDev, EnvProd))
+	flag.StringVar(&a.ConfigPath, configPathFlag, defaultConfigPath, "Path to folder with config")
+	flag.StringVar(&a.ConfigPrefix, configPrefixFlag, defaultConfigPrefix, "Prefix of config filename")
+	flag.StringVar(&a.Env, envFlag, defaultEnv, fmt.Sprintf("Environment alias: %s or %s", EnvDev, EnvProd))
+	flag.StringVar(&a.Network, networkFlag, "", "Name of network from config, overrides `network` value of config")
 
 	flag.Parse()
+
+	if flag.NArg() > 0 {
+		a.Command = flag.Arg(0)
+		a.CommandArgs = flag.Args()[1:]
+	}
 }
 
 // Validate current values
@@ -49,5 +61,9 @@ func (a *Args) Validate() error {
 		return fmt.Errorf("wrong environment")
 	}
 
+	if a.Command != "" && a.Command != CommandMigrate {
+		return fmt.Errorf("unknown command `%s`", a.Command)
+	}
+
 	return nil
 }
@@ -0,0 +1,64 @@
+package blockchain
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/kainobor/eth-client/app/config"
+	"github.com/kainobor/eth-client/app/helper"
+)
+
+const (
+	chainIDMethod    = "eth_chainId"
+	netVersionMethod = "net_version"
+
+	methodNotFoundErrorCode = -32601
+)
+
+// verifyChain checks that node works in network with chain ID and network ID from config,
+// so transactions are never sent to another network
+func verifyChain(ctx context.Context, rc *rpc.Client, c *config.BlockchainConfig) error {
+	if c.ChainID <= 0 {
+		return fmt.Errorf("chain ID is not configured")
+	}
+
+	var chainIDHex string
+	err := rc.CallContext(ctx, &chainIDHex, chainIDMethod)
+	if isMethodNotFound(err) {
+		// Nodes before EIP-695 are checked only by network ID
+	} else if err != nil {
+		return fmt.Errorf("can't get chain ID: %v", err)
+	} else {
+		chainID, ok := helper.HexToBig(chainIDHex)
+		if !ok {
+			return fmt.Errorf("can't parse `%s` as chain ID", chainIDHex)
+		} else if chainID.Cmp(big.NewInt(c.ChainID)) != 0 {
+			return fmt.Errorf("node has chain ID %s, expected %d", chainID.String(), c.ChainID)
+		}
+	}
+
+	var netVersion string
+	if err := rc.CallContext(ctx, &netVersion, netVersionMethod); err != nil {
+		return fmt.Errorf("can't get network ID: %v", err)
+	}
+
+	networkID := c.NetworkID
+	if networkID <= 0 {
+		networkID = c.ChainID
+	}
+	if netVersion != strconv.FormatInt(networkID, 10) {
+		return fmt.Errorf("node has network ID %s, expected %d", netVersion, networkID)
+	}
+
+	return nil
+}
+
+// isMethodNotFound checks that node doesn't support called method
+func isMethodNotFound(err error) bool {
+	nodeErr, ok := err.(rpc.Error)
+
+	return ok && nodeErr.ErrorCode() == methodNotFoundErrorCode
+}
@@ -1,61 +1,294 @@
 package blockchain
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"math/big"
+	"strings"
+	"sync"
 
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/kainobor/eth-client/app/config"
 	"github.com/kainobor/eth-client/app/helper"
+	"github.com/kainobor/eth-client/app/logger"
 )
 
+// ErrTransactionNotFound is returned when network doesn't know transaction
+var ErrTransactionNotFound = errors.New("transaction not found")
+
 type (
 	// Client represents client of ethereum network
 	Client struct {
 		config *config.BlockchainConfig
-		rpc    *rpc.Client
+		pool   *pool
+		ws     *rpc.Client
+		wsMu   sync.Mutex // Websocket is reconnected while other goroutines subscribe or close client
+		signer *Signer
+		nonces *NonceManager
+		fees   *FeeEstimator
+		tokens *TokenRegistry
+		log    *logger.Logger
 	}
 )
 
 const (
-	sendTransactionMethod      = "eth_sendTransaction"
+	sendRawTransactionMethod   = "eth_sendRawTransaction"
+	getTransactionCountMethod  = "eth_getTransactionCount"
+	gasPriceMethod             = "eth_gasPrice"
+	estimateGasMethod          = "eth_estimateGas"
 	getTransactionByHashMethod = "eth_getTransactionByHash"
+	getReceiptMethod           = "eth_getTransactionReceipt"
 	getBlockByNumberMethod     = "eth_getBlockByNumber"
 	getBalanceMethod           = "eth_getBalance"
 	getCurrentBlockMethod      = "eth_blockNumber"
+
+	newHeadsSubscription = "newHeads"
 )
 
 // New client of ethereum network
-func New(c *config.BlockchainConfig) *Client {
-	return &Client{config: c}
+func New(c *config.BlockchainConfig, log *logger.Logger) *Client {
+	cl := &Client{config: c, pool: newPool(c, log), log: log}
+	cl.nonces = NewNonceManager(cl)
+	cl.fees = NewFeeEstimator(c.Fee, cl)
+	cl.tokens = NewTokenRegistry(c.Tokens)
+
+	return cl
 }
 
 // Init connections to network
-func (cl *Client) Init() error {
-	fullAddr := fmt.Sprintf("http://%s:%d", cl.config.IP, cl.config.Port)
+func (cl *Client) Init(ctx context.Context) error {
 	var err error
 
-	if cl.rpc, err = rpc.Dial(fullAddr); err != nil {
-		return fmt.Errorf("error while connecting to RPC: %v", err)
+	if cl.signer, err = NewSigner(cl.config); err != nil {
+		return fmt.Errorf("error while loading private keys: %v", err)
+	}
+
+	if err = cl.pool.connect(ctx); err != nil {
+		return err
+	}
+
+	if cl.pool.hasWS() {
+		// Failed websocket is not fatal, handler polls blocks until it reconnects
+		if err = cl.ReconnectWS(ctx); err != nil {
+			cl.log.Errorw("can't connect to websocket, blocks are polled until reconnect", "error", err)
+		}
 	}
 
 	return nil
 }
 
-// SendTransaction sends unsigned transaction to network
-func (cl *Client) SendTransaction(t *Transaction) (string, error) {
-	var txID string
-	if err := cl.rpc.Call(&txID, sendTransactionMethod, t); err != nil {
+// SupportsSubscriptions checks that client has websocket endpoint
+func (cl *Client) SupportsSubscriptions() bool {
+	return cl.pool.hasWS()
+}
+
+// ReconnectWS closes current websocket connection if it exists
+// and dials new one to healthy endpoint
+func (cl *Client) ReconnectWS(ctx context.Context) error {
+	cl.wsMu.Lock()
+	defer cl.wsMu.Unlock()
+
+	if cl.ws != nil {
+		cl.ws.Close()
+		cl.ws = nil
+	}
+
+	ep, err := cl.pool.wsEndpoint()
+	if err != nil {
+		return err
+	}
+
+	ws, err := rpc.DialWebsocket(ctx, ep.wsURL(), "")
+	if err != nil {
+		return fmt.Errorf("error while connecting to websocket: %v", err)
+	}
+
+	verifyCtx, cancel := cl.pool.withTimeout(ctx, chainIDMethod)
+	defer cancel()
+	if err := verifyChain(verifyCtx, ws, cl.config); err != nil {
+		ws.Close()
+		return fmt.Errorf("wrong network of websocket `%s`: %v", ep.wsURL(), err)
+	}
+	cl.ws = ws
+
+	return nil
+}
+
+// SubscribeNewHeads subscribes to headers of new blocks through websocket endpoint
+func (cl *Client) SubscribeNewHeads(ctx context.Context, ch chan<- *Header) (Subscription, error) {
+	cl.wsMu.Lock()
+	defer cl.wsMu.Unlock()
+
+	if cl.ws == nil {
+		return nil, fmt.Errorf("websocket endpoint is not connected")
+	}
+
+	sub, err := cl.ws.EthSubscribe(ctx, ch, newHeadsSubscription)
+	if err != nil {
+		return nil, fmt.Errorf("error while subscribing to new heads: %v", err)
+	}
+
+	return sub, nil
+}
+
+// SendTransaction fills nonce and gas values, signs transaction locally
+// and sends it to network as raw transaction
+func (cl *Client) SendTransaction(ctx context.Context, t *Transaction) (string, error) {
+	if err := cl.SignTransaction(ctx, t); err != nil {
 		return "", err
 	}
 
+	txID, err := cl.broadcast(ctx, t)
+	if err != nil {
+		cl.nonces.Release(t.From(), t.Nonce())
+		if isNonceError(err) {
+			cl.nonces.Reset(t.From())
+		}
+		return "", err
+	}
+	cl.nonces.Commit(t.From(), t.Nonce())
+
+	return txID, nil
+}
+
+// SignTransaction fills nonce and gas values and signs transaction locally without sending.
+// Acquired nonce must be committed or released with nonce manager by caller
+func (cl *Client) SignTransaction(ctx context.Context, t *Transaction) error {
+	if !cl.signer.CanSign(t.From()) {
+		return fmt.Errorf("no private key for sender `%s`", t.From())
+	}
+
+	if err := cl.prepareTransaction(ctx, t); err != nil {
+		return err
+	}
+
+	nonce, err := cl.nonces.Acquire(ctx, t.From())
+	if err != nil {
+		return err
+	}
+	t.SetNonce(nonce)
+
+	if err := cl.signer.Sign(t); err != nil {
+		cl.nonces.Release(t.From(), nonce)
+		return err
+	}
+	t.SetHash(crypto.Keccak256Hash(t.Raw()).Hex())
+
+	return nil
+}
+
+// SignReplacement signs transaction with nonce of previous one, that is not mined yet,
+// so only one of them is mined. Fees are bumped over previous ones, as network requires.
+// Transaction is not sent, it must be saved before sending with Rebroadcast
+func (cl *Client) SignReplacement(ctx context.Context, t, prev *Transaction) error {
+	if !cl.signer.CanSign(t.From()) {
+		return fmt.Errorf("no private key for sender `%s`", t.From())
+	}
+
+	if err := cl.prepareTransaction(ctx, t); err != nil {
+		return err
+	}
+
+	if err := cl.fees.Bump(t, prev); err != nil {
+		return err
+	}
+	t.SetNonce(prev.Nonce())
+
+	if err := cl.signer.Sign(t); err != nil {
+		return err
+	}
+	t.SetHash(crypto.Keccak256Hash(t.Raw()).Hex())
+
+	return nil
+}
+
+// Rebroadcast sends already signed transaction again, for example when it was dropped from mempool
+func (cl *Client) Rebroadcast(ctx context.Context, t *Transaction) (string, error) {
+	if len(t.Raw()) == 0 {
+		return "", fmt.Errorf("transaction `%s` has no signed payload", t.Hash())
+	}
+
+	return cl.broadcast(ctx, t)
+}
+
+// broadcast sends signed transaction to network and returns its hash
+func (cl *Client) broadcast(ctx context.Context, t *Transaction) (string, error) {
+	var txID string
+	if err := cl.pool.call(ctx, &txID, sendRawTransactionMethod, hexutil.Encode(t.Raw())); err != nil {
+		if !isKnownTransactionError(err) {
+			return "", err
+		}
+
+		// Retried sending finds transaction, that was accepted by previous attempt
+		txID = crypto.Keccak256Hash(t.Raw()).Hex()
+	}
+
 	return txID, nil
 }
 
+// Tokens returns registry of known ERC-20 tokens
+func (cl *Client) Tokens() *TokenRegistry {
+	return cl.tokens
+}
+
+// Nonces returns nonce manager of client
+func (cl *Client) Nonces() *NonceManager {
+	return cl.nonces
+}
+
+// GetPendingNonce returns next nonce for address including pending transactions
+func (cl *Client) GetPendingNonce(ctx context.Context, addr string) (uint64, error) {
+	var nonceHex string
+	if err := cl.pool.call(ctx, &nonceHex, getTransactionCountMethod, "0x"+helper.TrimHexPrefix(addr), "pending"); err != nil {
+		return 0, fmt.Errorf("error while getting transaction count: %v", err)
+	}
+
+	nonce, ok := helper.HexToUint64(nonceHex)
+	if !ok {
+		return 0, fmt.Errorf("can't parse `%s` as nonce", nonceHex)
+	}
+
+	return nonce, nil
+}
+
+// GetGasPrice returns current gas price suggested by network
+func (cl *Client) GetGasPrice(ctx context.Context) (*big.Int, error) {
+	var priceHex string
+	if err := cl.pool.call(ctx, &priceHex, gasPriceMethod); err != nil {
+		return nil, fmt.Errorf("error while getting gas price: %v", err)
+	}
+
+	price, ok := helper.HexToBig(priceHex)
+	if !ok {
+		return nil, fmt.Errorf("can't parse `%s` as gas price", priceHex)
+	}
+
+	return price, nil
+}
+
+// EstimateGas returns gas amount that is needed for transaction execution
+func (cl *Client) EstimateGas(ctx context.Context, t *Transaction) (uint64, error) {
+	var gasHex string
+	if err := cl.pool.call(ctx, &gasHex, estimateGasMethod, t); err != nil {
+		return 0, fmt.Errorf("error while estimating gas: %v", err)
+	}
+
+	gas, ok := helper.HexToUint64(gasHex)
+	if !ok {
+		return 0, fmt.Errorf("can't parse `%s` as gas", gasHex)
+	}
+
+	return gas, nil
+}
+
 // GetBalance returns balance by some address
-func (cl *Client) GetBalance(addr string) (*big.Int, error) {
+func (cl *Client) GetBalance(ctx context.Context, addr string) (*big.Int, error) {
 	var balanceHex string
-	if err := cl.rpc.Call(&balanceHex, getBalanceMethod, addr, "latest"); err != nil {
+	if err := cl.pool.call(ctx, &balanceHex, getBalanceMethod, addr, "latest"); err != nil {
 		return nil, fmt.Errorf("error while getting balance: %v", err)
 	}
 
@@ -67,20 +300,144 @@ func (cl *Client) GetBalance(addr string) (*big.Int, error) {
 	return balance, nil
 }
 
+// GetBalances returns balances of addresses at block with tag. Requests are sent
+// in batches, several batches at once. Balances that were got are returned even if
+// some of requests failed
+func (cl *Client) GetBalances(ctx context.Context, addrs []string, blockTag string) (map[string]*big.Int, error) {
+	batchSize := cl.config.BalanceBatchSize
+	if batchSize <= 0 {
+		batchSize = len(addrs)
+	}
+	concurrency := cl.config.BalanceConcurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	balances := make(map[string]*big.Int, len(addrs))
+	var failed []string
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+
+	for start := 0; start < len(addrs); start += batchSize {
+		end := start + batchSize
+		if end > len(addrs) {
+			end = len(addrs)
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(part []string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			partBalances, partFailed := cl.getBalancesBatch(ctx, part, blockTag)
+
+			mu.Lock()
+			for addr, bal := range partBalances {
+				balances[addr] = bal
+			}
+			failed = append(failed, partFailed...)
+			mu.Unlock()
+		}(addrs[start:end])
+	}
+	wg.Wait()
+
+	if len(failed) > 0 {
+		return balances, fmt.Errorf("can't get balances of %d addresses: %s", len(failed), strings.Join(failed, ", "))
+	}
+
+	return balances, nil
+}
+
+// getBalancesBatch gets balances with one batch request and returns addresses that failed
+func (cl *Client) getBalancesBatch(ctx context.Context, addrs []string, blockTag string) (map[string]*big.Int, []string) {
+	balances := make(map[string]*big.Int, len(addrs))
+	results := make([]string, len(addrs))
+	batch := make([]rpc.BatchElem, len(addrs))
+	for i, addr := range addrs {
+		batch[i] = rpc.BatchElem{
+			Method: getBalanceMethod,
+			Args:   []interface{}{"0x" + helper.TrimHexPrefix(addr), blockTag},
+			Result: &results[i],
+		}
+	}
+
+	if err := cl.pool.batchCall(ctx, batch); err != nil {
+		return balances, addrs
+	}
+
+	var failed []string
+	for i, elem := range batch {
+		if elem.Error != nil {
+			failed = append(failed, addrs[i])
+			continue
+		}
+
+		balance, ok := helper.HexToBig(results[i])
+		if !ok {
+			failed = append(failed, addrs[i])
+			continue
+		}
+		balances[addrs[i]] = balance
+	}
+
+	return balances, failed
+}
+
 // RenewTransaction renews transaction values from network
-func (cl *Client) RenewTransaction(t *Transaction) error {
-	err := cl.rpc.Call(&t, getTransactionByHashMethod, t.Hash())
+func (cl *Client) RenewTransaction(ctx context.Context, t *Transaction) error {
+	var raw json.RawMessage
+	err := cl.pool.call(ctx, &raw, getTransactionByHashMethod, t.Hash())
 	if err != nil {
 		return fmt.Errorf("can't get transaction: %v", err)
+	} else if len(raw) == 0 || string(raw) == "null" {
+		return ErrTransactionNotFound
 	}
 
-	return nil
+	return json.Unmarshal(raw, t)
+}
+
+// GetReceipt returns receipt of transaction, or nil if transaction is not mined yet
+func (cl *Client) GetReceipt(ctx context.Context, hash string) (*Receipt, error) {
+	var receipt *Receipt
+	if err := cl.pool.call(ctx, &receipt, getReceiptMethod, hash); err != nil {
+		return nil, fmt.Errorf("can't get receipt: %v", err)
+	}
+
+	return receipt, nil
+}
+
+// GetBlockTransactions returns header of block with some number and all its transactions
+func (cl *Client) GetBlockTransactions(ctx context.Context, blockNumber big.Int) (*Header, []*Transaction, error) {
+	var raw json.RawMessage
+	if err := cl.pool.call(ctx, &raw, getBlockByNumberMethod, helper.BigToHex(blockNumber), true); err != nil {
+		return nil, nil, fmt.Errorf("can't get block by number: %v", err)
+	} else if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil, fmt.Errorf("block %s not found", blockNumber.String())
+	}
+
+	header := new(Header)
+	if err := json.Unmarshal(raw, header); err != nil {
+		return nil, nil, err
+	}
+
+	var body struct {
+		Transactions []*Transaction `json:"transactions"`
+	}
+	if err := json.Unmarshal(raw, &body); err != nil {
+		return nil, nil, fmt.Errorf("error while unmarshaling block transactions: %v", err)
+	}
+
+	return header, body.Transactions, nil
 }
 
 // GetCurrentBlock returns most recent block from network
-func (cl *Client) GetCurrentBlock() (*big.Int, error) {
+func (cl *Client) GetCurrentBlock(ctx context.Context) (*big.Int, error) {
 	var blockNumHex string
-	if err := cl.rpc.Call(&blockNumHex, getCurrentBlockMethod); err != nil {
+	if err := cl.pool.call(ctx, &blockNumHex, getCurrentBlockMethod); err != nil {
 		return nil, fmt.Errorf("error while getting current block: %v", err)
 	}
 
@@ -93,10 +450,10 @@ func (cl *Client) GetCurrentBlock() (*big.Int, error) {
 }
 
 // BlockExists checks that block with certain hash and number exists in network
-func (cl *Client) BlockExists(blockNumber big.Int, blockHash string) (bool, error) {
+func (cl *Client) BlockExists(ctx context.Context, blockNumber big.Int, blockHash string) (bool, error) {
 	var blockData = make(map[string]interface{})
 
-	err := cl.rpc.Call(&blockData, getBlockByNumberMethod, helper.BigToHex(blockNumber), false)
+	err := cl.pool.call(ctx, &blockData, getBlockByNumberMethod, helper.BigToHex(blockNumber), false)
 	if err != nil {
 		return false, fmt.Errorf("can't get block by number: %v", err)
 	}
@@ -104,18 +461,62 @@ func (cl *Client) BlockExists(blockNumber big.Int, blockHash string) (bool, erro
 	blockHashRaw, ok := blockData["hash"]
 	if !ok {
 		return false, fmt.Errorf("can't get hash from block data")
-	} else if blockHashRaw.(string) == "" {
+	}
+	// Hash can be null, as in pending block
+	hash, ok := blockHashRaw.(string)
+	if !ok {
+		return false, fmt.Errorf("wrong block hash: %v", blockHashRaw)
+	} else if hash == "" {
 		return false, fmt.Errorf("empty block hash")
 	}
 
-	if blockHashRaw == blockHashRaw.(string) {
-		return true, nil
+	return hash == blockHash, nil
+}
+
+// GetHeader returns header of block with some number
+func (cl *Client) GetHeader(ctx context.Context, blockNumber big.Int) (*Header, error) {
+	var header *Header
+	if err := cl.pool.call(ctx, &header, getBlockByNumberMethod, helper.BigToHex(blockNumber), false); err != nil {
+		return nil, fmt.Errorf("can't get block by number: %v", err)
+	} else if header == nil {
+		return nil, fmt.Errorf("block %s not found", blockNumber.String())
+	}
+
+	return header, nil
+}
+
+// prepareTransaction fills gas values that are needed for signing
+func (cl *Client) prepareTransaction(ctx context.Context, t *Transaction) error {
+	fees, err := cl.fees.Estimate(ctx, t)
+	if err != nil {
+		return fmt.Errorf("can't estimate fees: %v", err)
 	}
+	t.ApplyFees(fees)
 
-	return false, nil
+	return nil
 }
 
-// Close connection
+// isNonceError checks that network rejected transaction because of nonce counter was outdated.
+// Underpriced replacement is not such error, it is rejected because of fees for taken nonce
+func isNonceError(err error) bool {
+	return strings.Contains(strings.ToLower(err.Error()), "nonce too low")
+}
+
+// isKnownTransactionError checks that network already has transaction with the same hash
+func isKnownTransactionError(err error) bool {
+	msg := strings.ToLower(err.Error())
+
+	return strings.Contains(msg, "already known") || strings.Contains(msg, "known transaction")
+}
+
+// Close connections
 func (cl *Client) Close() {
-	cl.rpc.Close()
+	cl.pool.close()
+
+	cl.wsMu.Lock()
+	defer cl.wsMu.Unlock()
+	if cl.ws != nil {
+		cl.ws.Close()
+		cl.ws = nil
+	}
 }
@@ -0,0 +1,104 @@
+package blockchain
+
+import (
+	"context"
+	"math/big"
+	"net"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/kainobor/eth-client/app/config"
+)
+
+// BlockNode is eth namespace of node, that returns the same block by any number
+type BlockNode struct {
+	block map[string]interface{}
+}
+
+func (n *BlockNode) GetBlockByNumber(number string, full bool) (map[string]interface{}, error) {
+	return n.block, nil
+}
+
+func TestBlockExists(t *testing.T) {
+	tests := []struct {
+		name   string
+		block  map[string]interface{}
+		exists bool
+		fail   bool
+	}{
+		{name: "the same hash", block: map[string]interface{}{"hash": "0xb1"}, exists: true},
+		{name: "other hash", block: map[string]interface{}{"hash": "0xb2"}},
+		{name: "null hash", block: map[string]interface{}{"hash": nil}, fail: true},
+		{name: "empty hash", block: map[string]interface{}{"hash": ""}, fail: true},
+		{name: "without hash", block: map[string]interface{}{"number": "0x10"}, fail: true},
+		{name: "unknown block", fail: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cl := newTestClient(t, &BlockNode{block: tt.block})
+			exists, err := cl.BlockExists(context.Background(), *big.NewInt(16), "0xb1")
+			if tt.fail {
+				if err == nil {
+					t.Error("expected error of wrong block")
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if exists != tt.exists {
+				t.Errorf("expected block exists %t, got %t", tt.exists, exists)
+			}
+		})
+	}
+}
+
+func TestWebsocketReconnect(t *testing.T) {
+	server := rpc.NewServer()
+	for _, namespace := range []string{"eth", "net"} {
+		if err := server.RegisterName(namespace, &HealthNode{chainID: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer server.Stop()
+	ws := httptest.NewServer(server.WebsocketHandler([]string{"*"}))
+	defer ws.Close()
+
+	host, port, err := net.SplitHostPort(ws.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	wsPort, _ := strconv.Atoi(port)
+	p := newTestPool(&config.BlockchainConfig{ChainID: 1}, &endpoint{config: &config.EndpointConfig{IP: host, WSPort: wsPort}, healthy: true})
+	cl := &Client{config: p.config, pool: p, log: p.log}
+
+	if err := cl.ReconnectWS(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Handler reconnects websocket while blocks are subscribed, and client can be closed at any time
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			cl.ReconnectWS(context.Background())
+		}()
+		go func() {
+			defer wg.Done()
+			if sub, err := cl.SubscribeNewHeads(context.Background(), make(chan *Header)); err == nil {
+				sub.Unsubscribe()
+			}
+		}()
+	}
+	wg.Wait()
+
+	cl.Close()
+	if _, err := cl.SubscribeNewHeads(context.Background(), make(chan *Header)); err == nil {
+		t.Error("expected error of closed websocket")
+	}
+}
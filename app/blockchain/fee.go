@@ -0,0 +1,274 @@
+package blockchain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/kainobor/eth-client/app/config"
+	"github.com/kainobor/eth-client/app/helper"
+)
+
+type (
+	// FeeEstimator calculates gas and fees for outgoing transactions
+	FeeEstimator struct {
+		config   *config.FeeConfig
+		strategy string // Strategy from config or normal one
+		cl       *Client
+	}
+
+	// Fees is result of estimation
+	Fees struct {
+		Gas                  uint64
+		GasPrice             big.Int // Set for networks without EIP-1559
+		MaxFeePerGas         big.Int
+		MaxPriorityFeePerGas big.Int
+	}
+
+	// feeStrategy describes how fast transaction should be mined
+	feeStrategy struct {
+		percentile float64 // Percentile of priority fees in recent blocks
+		baseFeeMul float64 // Reserve for base fee growth
+		priceMul   float64 // Multiplier of gas price for legacy networks
+	}
+
+	feeHistory struct {
+		BaseFeePerGas []string   `json:"baseFeePerGas"`
+		Reward        [][]string `json:"reward"`
+	}
+)
+
+const (
+	// SlowFeeStrategy for transactions that can wait
+	SlowFeeStrategy = "slow"
+	// NormalFeeStrategy for ordinary transactions
+	NormalFeeStrategy = "normal"
+	// FastFeeStrategy for transactions that should be mined in next blocks
+	FastFeeStrategy = "fast"
+
+	feeHistoryMethod           = "eth_feeHistory"
+	maxPriorityFeePerGasMethod = "eth_maxPriorityFeePerGas"
+
+	defaultHistoryBlocks = 10
+
+	// replacementBump is minimal growth of fees, that allows node to replace transaction in mempool
+	replacementBump = 1.1
+)
+
+// errNoDynamicFees is returned when network doesn't support EIP-1559, so legacy gas price is used
+var errNoDynamicFees = errors.New("network doesn't support dynamic fees")
+
+var (
+	feeStrategies = map[string]feeStrategy{
+		SlowFeeStrategy:   {percentile: 10, baseFeeMul: 1.25, priceMul: 0.9},
+		NormalFeeStrategy: {percentile: 50, baseFeeMul: 2, priceMul: 1},
+		FastFeeStrategy:   {percentile: 90, baseFeeMul: 2.5, priceMul: 1.25},
+	}
+
+	gwei = big.NewInt(1000000000)
+)
+
+// NewFeeEstimator is constructor for fee estimator. Normal strategy is used if fees are not configured
+func NewFeeEstimator(c *config.FeeConfig, cl *Client) *FeeEstimator {
+	if c == nil {
+		c = new(config.FeeConfig)
+	}
+
+	fe := &FeeEstimator{config: c, strategy: c.Strategy, cl: cl}
+	if fe.strategy == "" {
+		fe.strategy = NormalFeeStrategy
+	}
+
+	return fe
+}
+
+// Estimate returns gas and fees for transaction according to configured strategy
+func (fe *FeeEstimator) Estimate(ctx context.Context, t *Transaction) (*Fees, error) {
+	strategy, ok := feeStrategies[fe.strategy]
+	if !ok {
+		return nil, fmt.Errorf("unknown fee strategy `%s`", fe.strategy)
+	}
+
+	gas, err := fe.cl.EstimateGas(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+
+	fees := &Fees{Gas: gas}
+	if fe.config.GasMultiplier > 0 {
+		fees.Gas = uint64(float64(gas) * fe.config.GasMultiplier)
+	}
+
+	baseFee, tip, err := fe.dynamicFees(ctx, strategy)
+	if err == errNoDynamicFees {
+		return fe.legacyFees(ctx, fees, strategy)
+	} else if err != nil {
+		return nil, err
+	}
+
+	maxFee := mulBig(baseFee, strategy.baseFeeMul)
+	maxFee.Add(maxFee, tip)
+
+	if feeCap := fe.maxFeeCap(); feeCap != nil && maxFee.Cmp(feeCap) > 0 {
+		maxFee = feeCap
+	}
+	if tip.Cmp(maxFee) > 0 {
+		tip = new(big.Int).Set(maxFee)
+	}
+
+	fees.MaxFeePerGas = *maxFee
+	fees.MaxPriorityFeePerGas = *tip
+
+	return fees, nil
+}
+
+// dynamicFees returns base fee of next block and priority fee for strategy.
+// errNoDynamicFees is returned if node doesn't know fee methods or blocks don't have base fee
+func (fe *FeeEstimator) dynamicFees(ctx context.Context, strategy feeStrategy) (*big.Int, *big.Int, error) {
+	blocks := fe.config.HistoryBlocks
+	if blocks <= 0 {
+		blocks = defaultHistoryBlocks
+	}
+
+	var history feeHistory
+	err := fe.cl.pool.call(ctx, &history, feeHistoryMethod, helper.BigToHex(*big.NewInt(int64(blocks))), "latest", []float64{strategy.percentile})
+	if isMethodNotFound(err) {
+		return nil, nil, errNoDynamicFees
+	} else if err != nil {
+		return nil, nil, fmt.Errorf("error while getting fee history: %v", err)
+	}
+
+	if len(history.BaseFeePerGas) == 0 {
+		return nil, nil, errNoDynamicFees
+	}
+
+	// Last value is base fee of the next block
+	baseFeeHex := history.BaseFeePerGas[len(history.BaseFeePerGas)-1]
+	baseFee, ok := helper.HexToBig(baseFeeHex)
+	if !ok {
+		return nil, nil, fmt.Errorf("can't parse `%s` as base fee", baseFeeHex)
+	} else if baseFee.BitLen() == 0 {
+		// Blocks before London fork have zero base fee
+		return nil, nil, errNoDynamicFees
+	}
+
+	tip := big.NewInt(0)
+	var count int64
+	for _, rewards := range history.Reward {
+		if len(rewards) == 0 {
+			continue
+		}
+		if reward, ok := helper.HexToBig(rewards[0]); ok {
+			tip.Add(tip, reward)
+			count++
+		}
+	}
+
+	if count > 0 {
+		tip.Div(tip, big.NewInt(count))
+	}
+
+	if tip.BitLen() == 0 {
+		var tipHex string
+		if err := fe.cl.pool.call(ctx, &tipHex, maxPriorityFeePerGasMethod); isMethodNotFound(err) {
+			return nil, nil, errNoDynamicFees
+		} else if err != nil {
+			return nil, nil, fmt.Errorf("error while getting priority fee: %v", err)
+		}
+		if tip, ok = helper.HexToBig(tipHex); !ok {
+			return nil, nil, fmt.Errorf("can't parse `%s` as priority fee", tipHex)
+		}
+	}
+
+	return baseFee, tip, nil
+}
+
+func (fe *FeeEstimator) legacyFees(ctx context.Context, fees *Fees, strategy feeStrategy) (*Fees, error) {
+	price, err := fe.cl.GetGasPrice(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	price = mulBig(price, strategy.priceMul)
+	if feeCap := fe.maxFeeCap(); feeCap != nil && price.Cmp(feeCap) > 0 {
+		price = feeCap
+	}
+	fees.GasPrice = *price
+
+	return fees, nil
+}
+
+// Bump raises fees of transaction to replace previous one with the same nonce.
+// Each fee becomes not less than previous one with replacementBump
+func (fe *FeeEstimator) Bump(t, prev *Transaction) error {
+	fees := &Fees{
+		Gas:                  t.Gas(),
+		GasPrice:             t.GasPrice(),
+		MaxFeePerGas:         t.MaxFeePerGas(),
+		MaxPriorityFeePerGas: t.MaxPriorityFeePerGas(),
+	}
+
+	// Legacy transaction pays the same gas price as tip and as max fee
+	prevMaxFee, prevTip := prev.MaxFeePerGas(), prev.MaxPriorityFeePerGas()
+	if !prev.IsDynamicFee() {
+		prevMaxFee, prevTip = prev.GasPrice(), prev.GasPrice()
+	}
+
+	if t.IsDynamicFee() {
+		fees.MaxFeePerGas = *maxBig(&fees.MaxFeePerGas, bumpFee(&prevMaxFee))
+		fees.MaxPriorityFeePerGas = *maxBig(&fees.MaxPriorityFeePerGas, bumpFee(&prevTip))
+		if fees.MaxPriorityFeePerGas.Cmp(&fees.MaxFeePerGas) > 0 {
+			fees.MaxFeePerGas = fees.MaxPriorityFeePerGas
+		}
+	} else {
+		fees.GasPrice = *maxBig(&fees.GasPrice, bumpFee(&prevMaxFee))
+	}
+
+	feeCap := fe.maxFeeCap()
+	if feeCap != nil && (fees.MaxFeePerGas.Cmp(feeCap) > 0 || fees.GasPrice.Cmp(feeCap) > 0) {
+		return fmt.Errorf("fee of replacement exceeds cap of %d gwei", fe.config.MaxFeeCapGwei)
+	}
+
+	t.ApplyFees(fees)
+
+	return nil
+}
+
+// maxFeeCap returns configured limit of fee per gas in wei
+func (fe *FeeEstimator) maxFeeCap() *big.Int {
+	if fe.config.MaxFeeCapGwei <= 0 {
+		return nil
+	}
+
+	return new(big.Int).Mul(big.NewInt(fe.config.MaxFeeCapGwei), gwei)
+}
+
+// bumpFee returns fee, that is enough for replacement of transaction with some fee.
+// Result is rounded up, so it is never below required bump
+func bumpFee(fee *big.Int) *big.Int {
+	bumped := new(big.Int).Mul(fee, big.NewInt(int64(replacementBump*1000)))
+	bumped.Add(bumped, big.NewInt(999))
+	bumped.Div(bumped, big.NewInt(1000))
+	if bumped.Cmp(fee) <= 0 {
+		bumped.Add(fee, big.NewInt(1))
+	}
+
+	return bumped
+}
+
+// maxBig returns bigger of two values
+func maxBig(a, b *big.Int) *big.Int {
+	if a.Cmp(b) >= 0 {
+		return new(big.Int).Set(a)
+	}
+
+	return new(big.Int).Set(b)
+}
+
+// mulBig multiplies big integer by float factor with precision of thousandths
+func mulBig(val *big.Int, factor float64) *big.Int {
+	res := new(big.Int).Mul(val, big.NewInt(int64(factor*1000)))
+
+	return res.Div(res, big.NewInt(1000))
+}
@@ -0,0 +1,283 @@
+package blockchain
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/kainobor/eth-client/app/config"
+	"github.com/kainobor/eth-client/app/helper"
+)
+
+// LegacyNode is eth namespace of node without EIP-1559 methods,
+// it is exported as RPC server registers only exported services
+type LegacyNode struct {
+	gasPrice int64
+}
+
+func (n *LegacyNode) EstimateGas(tx map[string]interface{}) (string, error) {
+	return "0x5208", nil
+}
+
+func (n *LegacyNode) GasPrice() (string, error) {
+	return helper.BigToHex(*big.NewInt(n.gasPrice)), nil
+}
+
+// DynamicFeeNode is eth namespace of node with EIP-1559 methods
+type DynamicFeeNode struct {
+	LegacyNode
+	baseFee    int64
+	rewards    []int64
+	tip        int64
+	err        error
+	percentile float64 // Percentile of the last fee history request
+}
+
+func (n *DynamicFeeNode) FeeHistory(blocks, newest string, percentiles []float64) (map[string]interface{}, error) {
+	if n.err != nil {
+		return nil, n.err
+	}
+	n.percentile = percentiles[0]
+
+	rewards := make([][]string, 0, len(n.rewards))
+	for _, reward := range n.rewards {
+		rewards = append(rewards, []string{helper.BigToHex(*big.NewInt(reward))})
+	}
+
+	return map[string]interface{}{
+		"baseFeePerGas": []string{"0x1", helper.BigToHex(*big.NewInt(n.baseFee))},
+		"reward":        rewards,
+	}, nil
+}
+
+func (n *DynamicFeeNode) MaxPriorityFeePerGas() (string, error) {
+	return helper.BigToHex(*big.NewInt(n.tip)), nil
+}
+
+func TestEstimateDynamicFees(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     *config.FeeConfig
+		node       *DynamicFeeNode
+		percentile float64
+		gas        uint64
+		maxFee     int64
+		tip        int64
+	}{
+		{
+			name:       "default strategy",
+			node:       &DynamicFeeNode{baseFee: 100, rewards: []int64{2, 4}},
+			percentile: 50, gas: 21000, maxFee: 203, tip: 3,
+		},
+		{
+			name:       "slow strategy",
+			config:     &config.FeeConfig{Strategy: SlowFeeStrategy},
+			node:       &DynamicFeeNode{baseFee: 100, rewards: []int64{2, 4}},
+			percentile: 10, gas: 21000, maxFee: 128, tip: 3,
+		},
+		{
+			name:       "fast strategy with gas reserve",
+			config:     &config.FeeConfig{Strategy: FastFeeStrategy, GasMultiplier: 1.2},
+			node:       &DynamicFeeNode{baseFee: 100, rewards: []int64{2, 4}},
+			percentile: 90, gas: 25200, maxFee: 253, tip: 3,
+		},
+		{
+			name:       "priority fee of node without rewards",
+			config:     &config.FeeConfig{Strategy: NormalFeeStrategy},
+			node:       &DynamicFeeNode{baseFee: 100, tip: 7},
+			percentile: 50, gas: 21000, maxFee: 207, tip: 7,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fees, err := NewFeeEstimator(tt.config, newTestClient(t, tt.node)).Estimate(context.Background(), testTransaction(t))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.node.percentile != tt.percentile {
+				t.Errorf("expected percentile %v, got %v", tt.percentile, tt.node.percentile)
+			}
+			checkFees(t, fees, tt.gas, 0, tt.maxFee, tt.tip)
+		})
+	}
+}
+
+func TestEstimateCapsFees(t *testing.T) {
+	gweis := func(n int64) int64 { return n * gwei.Int64() }
+	node := &DynamicFeeNode{baseFee: gweis(100), rewards: []int64{gweis(3)}}
+	cl := newTestClient(t, node)
+
+	fees, err := NewFeeEstimator(&config.FeeConfig{MaxFeeCapGwei: 150}, cl).Estimate(context.Background(), testTransaction(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFees(t, fees, 21000, 0, gweis(150), gweis(3))
+
+	// Tip is never bigger than max fee
+	fees, err = NewFeeEstimator(&config.FeeConfig{MaxFeeCapGwei: 2}, cl).Estimate(context.Background(), testTransaction(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFees(t, fees, 21000, 0, gweis(2), gweis(2))
+
+	legacy := newTestClient(t, &LegacyNode{gasPrice: gweis(20)})
+	fees, err = NewFeeEstimator(&config.FeeConfig{MaxFeeCapGwei: 15}, legacy).Estimate(context.Background(), testTransaction(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFees(t, fees, 21000, gweis(15), 0, 0)
+}
+
+func TestEstimateLegacyFees(t *testing.T) {
+	tests := []struct {
+		name     string
+		node     interface{}
+		strategy string
+		gasPrice int64
+	}{
+		{name: "node without fee history", node: &LegacyNode{gasPrice: 1000}, strategy: NormalFeeStrategy, gasPrice: 1000},
+		{name: "fast strategy", node: &LegacyNode{gasPrice: 1000}, strategy: FastFeeStrategy, gasPrice: 1250},
+		{name: "blocks without base fee", node: &DynamicFeeNode{LegacyNode: LegacyNode{gasPrice: 1000}}, strategy: SlowFeeStrategy, gasPrice: 900},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &config.FeeConfig{Strategy: tt.strategy}
+			fees, err := NewFeeEstimator(c, newTestClient(t, tt.node)).Estimate(context.Background(), testTransaction(t))
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkFees(t, fees, 21000, tt.gasPrice, 0, 0)
+		})
+	}
+}
+
+func TestEstimateErrors(t *testing.T) {
+	// Failed fee history is not treated as legacy network
+	node := &DynamicFeeNode{LegacyNode: LegacyNode{gasPrice: 1000}, err: errors.New("history is pruned")}
+	if _, err := NewFeeEstimator(nil, newTestClient(t, node)).Estimate(context.Background(), testTransaction(t)); err == nil {
+		t.Error("expected error of fee history")
+	}
+
+	c := &config.FeeConfig{Strategy: "instant"}
+	if _, err := NewFeeEstimator(c, newTestClient(t, &LegacyNode{})).Estimate(context.Background(), testTransaction(t)); err == nil {
+		t.Error("expected error of unknown strategy")
+	}
+
+	// Default strategy is not written to shared config
+	c = &config.FeeConfig{}
+	NewFeeEstimator(c, nil)
+	if c.Strategy != "" {
+		t.Errorf("config is changed to strategy `%s`", c.Strategy)
+	}
+}
+
+func TestBump(t *testing.T) {
+	tests := []struct {
+		name    string
+		prev    Fees
+		next    Fees // Estimated fees of replacement
+		capGwei int64
+		bumped  Fees
+		fail    bool
+	}{
+		{
+			name:   "dynamic fees are bumped by 10%",
+			prev:   Fees{MaxFeePerGas: *big.NewInt(100), MaxPriorityFeePerGas: *big.NewInt(10)},
+			next:   Fees{MaxFeePerGas: *big.NewInt(50), MaxPriorityFeePerGas: *big.NewInt(5)},
+			bumped: Fees{MaxFeePerGas: *big.NewInt(110), MaxPriorityFeePerGas: *big.NewInt(11)},
+		},
+		{
+			name:   "bump is rounded up",
+			prev:   Fees{MaxFeePerGas: *big.NewInt(15), MaxPriorityFeePerGas: *big.NewInt(1)},
+			next:   Fees{MaxFeePerGas: *big.NewInt(1), MaxPriorityFeePerGas: *big.NewInt(1)},
+			bumped: Fees{MaxFeePerGas: *big.NewInt(17), MaxPriorityFeePerGas: *big.NewInt(2)},
+		},
+		{
+			name:   "bigger estimated fees stay",
+			prev:   Fees{MaxFeePerGas: *big.NewInt(100), MaxPriorityFeePerGas: *big.NewInt(10)},
+			next:   Fees{MaxFeePerGas: *big.NewInt(300), MaxPriorityFeePerGas: *big.NewInt(30)},
+			bumped: Fees{MaxFeePerGas: *big.NewInt(300), MaxPriorityFeePerGas: *big.NewInt(30)},
+		},
+		{
+			name:   "legacy price is bumped as both fees",
+			prev:   Fees{GasPrice: *big.NewInt(100)},
+			next:   Fees{MaxFeePerGas: *big.NewInt(50), MaxPriorityFeePerGas: *big.NewInt(5)},
+			bumped: Fees{MaxFeePerGas: *big.NewInt(110), MaxPriorityFeePerGas: *big.NewInt(110)},
+		},
+		{
+			name:   "legacy price",
+			prev:   Fees{GasPrice: *big.NewInt(1001)},
+			next:   Fees{GasPrice: *big.NewInt(900)},
+			bumped: Fees{GasPrice: *big.NewInt(1102)},
+		},
+		{
+			name:    "bump over fee cap",
+			prev:    Fees{MaxFeePerGas: *big.NewInt(gwei.Int64()), MaxPriorityFeePerGas: *big.NewInt(1)},
+			next:    Fees{MaxFeePerGas: *big.NewInt(1), MaxPriorityFeePerGas: *big.NewInt(1)},
+			capGwei: 1,
+			fail:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prev, next := testTransaction(t), testTransaction(t)
+			prev.ApplyFees(&tt.prev)
+			next.ApplyFees(&tt.next)
+
+			err := NewFeeEstimator(&config.FeeConfig{MaxFeeCapGwei: tt.capGwei}, nil).Bump(next, prev)
+			if tt.fail {
+				if err == nil {
+					t.Error("expected error of fee cap")
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			fees := &Fees{GasPrice: next.GasPrice(), MaxFeePerGas: next.MaxFeePerGas(), MaxPriorityFeePerGas: next.MaxPriorityFeePerGas()}
+			checkFees(t, fees, 0, tt.bumped.GasPrice.Int64(), tt.bumped.MaxFeePerGas.Int64(), tt.bumped.MaxPriorityFeePerGas.Int64())
+		})
+	}
+}
+
+// newTestClient returns client, which calls go to node with eth namespace in memory
+func newTestClient(t *testing.T, node interface{}) *Client {
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", node); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(server.Stop)
+
+	p := newTestPool(&config.BlockchainConfig{}, &endpoint{config: &config.EndpointConfig{}, rpc: rpc.DialInProc(server), healthy: true})
+
+	return &Client{config: p.config, pool: p, log: p.log}
+}
+
+func testTransaction(t *testing.T) *Transaction {
+	tx, err := NewTransaction(testSender, eip155To, "0x1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tx
+}
+
+func checkFees(t *testing.T, fees *Fees, gas uint64, gasPrice, maxFee, tip int64) {
+	t.Helper()
+	if gas > 0 && fees.Gas != gas {
+		t.Errorf("expected gas %d, got %d", gas, fees.Gas)
+	}
+	if fees.GasPrice.Int64() != gasPrice {
+		t.Errorf("expected gas price %d, got %s", gasPrice, fees.GasPrice.String())
+	}
+	if fees.MaxFeePerGas.Int64() != maxFee || fees.MaxPriorityFeePerGas.Int64() != tip {
+		t.Errorf("expected max fee %d and tip %d, got %s and %s", maxFee, tip, fees.MaxFeePerGas.String(), fees.MaxPriorityFeePerGas.String())
+	}
+}
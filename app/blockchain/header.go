@@ -0,0 +1,76 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/kainobor/eth-client/app/helper"
+)
+
+type (
+	// Header represents header of blockchain block
+	Header struct {
+		number     big.Int
+		hash       string
+		parentHash string
+	}
+
+	// ReorgEvent describes replacement of blocks in main chain
+	ReorgEvent struct {
+		Depth     int64  // Amount of replaced blocks
+		ForkBlock int64  // Last block that is common for old and new chains
+		OldHead   string // Hash of replaced block after fork
+		NewHead   string // Hash of new block after fork
+	}
+
+	// Subscription is subscription to network notifications
+	Subscription interface {
+		Err() <-chan error
+		Unsubscribe()
+	}
+)
+
+// NewHeader is constructor for headers
+func NewHeader(number big.Int, hash, parentHash string) *Header {
+	return &Header{number: number, hash: hash, parentHash: parentHash}
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface
+func (h *Header) UnmarshalJSON(data []byte) error {
+	params := struct {
+		Number     string `json:"number"`
+		Hash       string `json:"hash"`
+		ParentHash string `json:"parentHash"`
+	}{}
+
+	if err := json.Unmarshal(data, &params); err != nil {
+		return fmt.Errorf("error while unmarshaling header: %v", err)
+	}
+
+	number, ok := helper.HexToBig(params.Number)
+	if !ok {
+		return fmt.Errorf("wrong block number: %s", params.Number)
+	}
+
+	h.number = *number
+	h.hash = params.Hash
+	h.parentHash = params.ParentHash
+
+	return nil
+}
+
+// Number is getter
+func (h *Header) Number() big.Int {
+	return h.number
+}
+
+// Hash is getter
+func (h *Header) Hash() string {
+	return h.hash
+}
+
+// ParentHash is getter
+func (h *Header) ParentHash() string {
+	return h.parentHash
+}
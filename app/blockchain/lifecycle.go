@@ -0,0 +1,82 @@
+package blockchain
+
+import (
+	"fmt"
+	"time"
+)
+
+type (
+	// Transition is change of transaction status, that is kept in history
+	Transition struct {
+		RequestID  string // ID of send request, empty for transactions that were not sent through outbox
+		Hash       string // Empty until transaction is signed
+		FromStatus string // Empty for the first status
+		ToStatus   string
+		CreatedAt  time.Time
+	}
+)
+
+// Statuses of transaction lifecycle
+const (
+	// QueuedStatus is status of accepted send request, that is not signed yet
+	QueuedStatus = "queued"
+	// SignedStatus is status of transaction, that is signed, but maybe not sent yet
+	SignedStatus = "signed"
+	// BroadcastStatus is status of transaction, that is sent to network, but not mined
+	BroadcastStatus = "broadcast"
+	// MinedStatus is status of transaction, that is included in block, but doesn't have enough confirmations
+	MinedStatus = "mined"
+	// ConfirmedStatus is status of successful transaction with enough confirmations
+	ConfirmedStatus = "confirmed"
+	// RevertedStatus is status of transaction with enough confirmations, which execution failed
+	RevertedStatus = "reverted"
+	// DroppedStatus is status of transaction, that network doesn't know anymore, or send request that can't be sent
+	DroppedStatus = "dropped"
+	// ReplacedStatus is status of transaction, that was not mined because other one with the same nonce was
+	ReplacedStatus = "replaced"
+	// ReorgedStatus is status of transaction, which block is not in main chain anymore
+	ReorgedStatus = "reorged"
+)
+
+// transitions contains statuses, that transaction can get after its current one.
+// Empty status is of transaction, that is not saved yet
+var transitions = map[string][]string{
+	"":              {QueuedStatus, SignedStatus, BroadcastStatus, MinedStatus},
+	QueuedStatus:    {SignedStatus, DroppedStatus},
+	SignedStatus:    {BroadcastStatus, DroppedStatus},
+	BroadcastStatus: {MinedStatus, DroppedStatus, ReplacedStatus},
+	MinedStatus:     {ConfirmedStatus, RevertedStatus, ReorgedStatus},
+	ReorgedStatus:   {MinedStatus, DroppedStatus, ReplacedStatus},
+	DroppedStatus:   {BroadcastStatus, MinedStatus, ReplacedStatus},
+	// Only reorganization deeper than confirmations returns finished transaction back
+	ConfirmedStatus: {ReorgedStatus},
+	RevertedStatus:  {ReorgedStatus},
+}
+
+// ActiveStatuses are statuses of sent transactions, that are tracked until they get enough confirmations
+var ActiveStatuses = []string{BroadcastStatus, MinedStatus, ReorgedStatus, DroppedStatus}
+
+// CanTransit checks that transaction with one status can get another one
+func CanTransit(from, to string) bool {
+	for _, status := range transitions[from] {
+		if status == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NewTransition validates change of transaction status and returns record of it
+func NewTransition(hash, from, to string) (*Transition, error) {
+	if !CanTransit(from, to) {
+		return nil, fmt.Errorf("transaction `%s` can't change status from `%s` to `%s`", hash, from, to)
+	}
+
+	return &Transition{Hash: hash, FromStatus: from, ToStatus: to, CreatedAt: time.Now()}, nil
+}
+
+// IsPending checks that transaction with status is sent, but it is not in block
+func IsPending(status string) bool {
+	return status == BroadcastStatus || status == ReorgedStatus || status == DroppedStatus
+}
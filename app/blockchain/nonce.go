@@ -0,0 +1,180 @@
+package blockchain
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+type (
+	// NonceManager allocates nonces for concurrent sendings from the same addresses
+	NonceManager struct {
+		source  nonceSource
+		senders map[string]*senderNonces
+		sync.Mutex
+	}
+
+	// senderNonces contains nonce counter of one sender
+	senderNonces struct {
+		next     uint64
+		seeded   bool
+		inFlight map[uint64]bool
+		released []uint64 // Nonces of failed sendings, that must be reused before new ones
+		sync.Mutex
+	}
+
+	nonceSource interface {
+		GetPendingNonce(ctx context.Context, addr string) (uint64, error)
+	}
+)
+
+// NewNonceManager is constructor for nonce manager
+func NewNonceManager(source nonceSource) *NonceManager {
+	return &NonceManager{source: source, senders: make(map[string]*senderNonces)}
+}
+
+// Acquire returns next free nonce of sender. Counter is seeded from pending
+// transactions count of network on first use
+func (m *NonceManager) Acquire(ctx context.Context, addr string) (uint64, error) {
+	s := m.sender(addr)
+	s.Lock()
+	defer s.Unlock()
+
+	if !s.seeded {
+		if err := m.seed(ctx, addr, s); err != nil {
+			return 0, err
+		}
+	}
+
+	var nonce uint64
+	if len(s.released) > 0 {
+		nonce = s.released[0]
+		s.released = s.released[1:]
+	} else {
+		nonce = s.next
+		s.next++
+	}
+	s.inFlight[nonce] = true
+
+	return nonce, nil
+}
+
+// Commit marks nonce as used by transaction, that was accepted by network
+func (m *NonceManager) Commit(addr string, nonce uint64) {
+	s := m.sender(addr)
+	s.Lock()
+	delete(s.inFlight, nonce)
+	s.Unlock()
+}
+
+// Hold marks nonce as taken by transaction, that is signed, but not accepted by network yet,
+// so it is never given out again. Counter is moved after it
+func (m *NonceManager) Hold(addr string, nonce uint64) {
+	s := m.sender(addr)
+	s.Lock()
+	defer s.Unlock()
+
+	s.inFlight[nonce] = true
+	if s.seeded && nonce >= s.next {
+		s.next = nonce + 1
+	}
+}
+
+// Release returns nonce of failed sending back to sender's counter
+func (m *NonceManager) Release(addr string, nonce uint64) {
+	s := m.sender(addr)
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.inFlight, nonce)
+	s.released = append(s.released, nonce)
+	sort.Slice(s.released, func(i, j int) bool { return s.released[i] < s.released[j] })
+
+	// Last nonces can be just returned to counter
+	for len(s.released) > 0 && s.released[len(s.released)-1] == s.next-1 {
+		s.released = s.released[:len(s.released)-1]
+		s.next--
+	}
+}
+
+// Reset forces reseeding of sender's counter from network on next acquiring
+func (m *NonceManager) Reset(addr string) {
+	s := m.sender(addr)
+	s.Lock()
+	s.seeded = false
+	s.released = nil
+	s.Unlock()
+}
+
+// Gaps returns nonces, that were given out by manager, but are unknown for network
+func (m *NonceManager) Gaps(ctx context.Context, addr string) ([]uint64, error) {
+	s := m.sender(addr)
+	s.Lock()
+	defer s.Unlock()
+
+	if !s.seeded {
+		return nil, nil
+	}
+
+	pending, err := m.source.GetPendingNonce(ctx, addr)
+	if err != nil {
+		return nil, fmt.Errorf("can't get pending nonce of `%s`: %v", addr, err)
+	}
+
+	var gaps []uint64
+	for nonce := pending; nonce < s.next; nonce++ {
+		if !s.inFlight[nonce] {
+			gaps = append(gaps, nonce)
+		}
+	}
+
+	return gaps, nil
+}
+
+// Senders returns all addresses that have nonce counters
+func (m *NonceManager) Senders() []string {
+	m.Lock()
+	defer m.Unlock()
+
+	addrs := make([]string, 0, len(m.senders))
+	for addr := range m.senders {
+		addrs = append(addrs, addr)
+	}
+
+	return addrs
+}
+
+func (m *NonceManager) sender(addr string) *senderNonces {
+	addr = normalizeAddress(addr)
+
+	m.Lock()
+	defer m.Unlock()
+
+	s, ok := m.senders[addr]
+	if !ok {
+		s = &senderNonces{inFlight: make(map[uint64]bool)}
+		m.senders[addr] = s
+	}
+
+	return s
+}
+
+// seed sets counter from network, but never below nonces that are in flight now
+func (m *NonceManager) seed(ctx context.Context, addr string, s *senderNonces) error {
+	pending, err := m.source.GetPendingNonce(ctx, addr)
+	if err != nil {
+		return fmt.Errorf("can't get pending nonce of `%s`: %v", addr, err)
+	}
+
+	for nonce := range s.inFlight {
+		if nonce >= pending {
+			pending = nonce + 1
+		}
+	}
+
+	s.next = pending
+	s.seeded = true
+
+	return nil
+}
@@ -0,0 +1,216 @@
+package blockchain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+const testSender = "0xAaAaAaAaAaAaAaAaAaAaAaAaAaAaAaAaAaAaAaAa"
+
+// fakeNonces is network, that knows pending nonce of sender
+type fakeNonces struct {
+	pending uint64
+	calls   int
+	err     error
+	sync.Mutex
+}
+
+func (n *fakeNonces) GetPendingNonce(ctx context.Context, addr string) (uint64, error) {
+	n.Lock()
+	defer n.Unlock()
+
+	n.calls++
+
+	return n.pending, n.err
+}
+
+func (n *fakeNonces) setPending(pending uint64) {
+	n.Lock()
+	n.pending = pending
+	n.Unlock()
+}
+
+func TestNonceAcquire(t *testing.T) {
+	network := &fakeNonces{pending: 5}
+	m := NewNonceManager(network)
+
+	got := acquireN(t, m, 3)
+	if !reflect.DeepEqual(got, []uint64{5, 6, 7}) {
+		t.Errorf("expected nonces from pending one, got %v", got)
+	}
+	// Address is the same with other case and without prefix
+	if nonce := acquire(t, m, "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"); nonce != 8 {
+		t.Errorf("expected nonce 8 for the same sender, got %d", nonce)
+	}
+	if network.calls != 1 {
+		t.Errorf("expected one seeding from network, got %d", network.calls)
+	}
+
+	network.err = errors.New("node is down")
+	if _, err := NewNonceManager(network).Acquire(context.Background(), testSender); err == nil {
+		t.Error("expected error of seeding")
+	}
+}
+
+func TestNonceReleaseReuse(t *testing.T) {
+	tests := []struct {
+		name     string
+		release  []uint64
+		expected []uint64 // Next acquired nonces
+	}{
+		{name: "the lowest released first", release: []uint64{7, 5}, expected: []uint64{5, 7, 9}},
+		{name: "the last returns to counter", release: []uint64{8}, expected: []uint64{8, 9}},
+		{name: "released tail returns to counter", release: []uint64{8, 6, 7}, expected: []uint64{6, 7, 8}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewNonceManager(&fakeNonces{pending: 5})
+			acquireN(t, m, 4)
+			for _, nonce := range tt.release {
+				m.Release(testSender, nonce)
+			}
+
+			if got := acquireN(t, m, len(tt.expected)); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected nonces %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestNonceGaps(t *testing.T) {
+	network := &fakeNonces{pending: 5}
+	m := NewNonceManager(network)
+
+	if gaps, err := m.Gaps(context.Background(), testSender); err != nil || gaps != nil {
+		t.Errorf("expected no gaps of unknown sender, got %v, %v", gaps, err)
+	}
+
+	// 5 and 7 are accepted, but network lost them, 6 is still sending
+	acquireN(t, m, 3)
+	m.Commit(testSender, 5)
+	m.Commit(testSender, 7)
+	gaps, err := m.Gaps(context.Background(), testSender)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gaps, []uint64{5, 7}) {
+		t.Errorf("expected gaps [5 7], got %v", gaps)
+	}
+
+	network.setPending(8)
+	if gaps, _ := m.Gaps(context.Background(), testSender); len(gaps) != 0 {
+		t.Errorf("expected no gaps after network got all nonces, got %v", gaps)
+	}
+}
+
+func TestNonceResetAndHold(t *testing.T) {
+	network := &fakeNonces{pending: 5}
+	m := NewNonceManager(network)
+	acquireN(t, m, 3)
+	m.Commit(testSender, 5)
+	m.Release(testSender, 6)
+
+	// Transactions were sent by other client, but nonce 7 is still sending by this one
+	network.setPending(6)
+	m.Reset(testSender)
+	if nonce := acquire(t, m, testSender); nonce != 8 {
+		t.Errorf("expected nonce after one in flight, got %d", nonce)
+	}
+
+	m.Commit(testSender, 7)
+	m.Commit(testSender, 8)
+	network.setPending(20)
+	m.Reset(testSender)
+	if nonce := acquire(t, m, testSender); nonce != 20 {
+		t.Errorf("expected pending nonce of network after reset, got %d", nonce)
+	}
+
+	// Nonce of signed transaction, that is not sent yet, is never given out
+	m.Hold(testSender, 25)
+	m.Commit(testSender, 20)
+	if got := acquireN(t, m, 5); !reflect.DeepEqual(got, []uint64{26, 27, 28, 29, 30}) {
+		t.Errorf("expected nonces after held one, got %v", got)
+	}
+	m.Reset(testSender)
+	if nonce := acquire(t, m, testSender); nonce <= 30 {
+		t.Errorf("nonce %d in flight is given out again", nonce)
+	}
+}
+
+func TestNonceConcurrency(t *testing.T) {
+	network := &fakeNonces{pending: 100}
+	m := NewNonceManager(network)
+
+	var (
+		held = make(map[uint64]bool) // Nonces that are given out and not released
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		errs = make(chan error, 1000)
+	)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				nonce, err := m.Acquire(context.Background(), testSender)
+				if err != nil {
+					errs <- err
+					return
+				}
+
+				mu.Lock()
+				if held[nonce] {
+					errs <- fmt.Errorf("nonce %d is given out twice", nonce)
+				}
+				held[nonce] = true
+				mu.Unlock()
+
+				switch (worker + j) % 4 {
+				case 0:
+					mu.Lock()
+					delete(held, nonce)
+					mu.Unlock()
+					m.Release(testSender, nonce)
+				case 1:
+					m.Reset(testSender)
+				case 2:
+					if _, err := m.Gaps(context.Background(), testSender); err != nil {
+						errs <- err
+					}
+				}
+				// Other nonces stay in flight, so they are never given out again
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func acquire(t *testing.T, m *NonceManager, addr string) uint64 {
+	t.Helper()
+	nonce, err := m.Acquire(context.Background(), addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return nonce
+}
+
+func acquireN(t *testing.T, m *NonceManager, n int) []uint64 {
+	t.Helper()
+	nonces := make([]uint64, n)
+	for i := range nonces {
+		nonces[i] = acquire(t, m, testSender)
+	}
+
+	return nonces
+}
@@ -0,0 +1,437 @@
+package blockchain
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/kainobor/eth-client/app/config"
+	"github.com/kainobor/eth-client/app/helper"
+	"github.com/kainobor/eth-client/app/logger"
+)
+
+type (
+	// pool of RPC endpoints with health checks and failover
+	pool struct {
+		config    *config.BlockchainConfig
+		endpoints []*endpoint
+		stop      chan struct{}
+		log       *logger.Logger
+	}
+
+	// endpoint is one node of pool with its health statistics
+	endpoint struct {
+		config    *config.EndpointConfig
+		rpc       *rpc.Client
+		height    int64
+		reachable bool // Last probe succeeded
+		latency   time.Duration
+		errorRate float64 // Exponentially weighted share of failed calls
+		healthy   bool
+		failures  int       // Failed calls in a row
+		openedAt  time.Time // When circuit breaker was opened, zero if it is closed
+		trial     bool      // Trial call of half-open breaker is in progress
+		sync.RWMutex
+	}
+)
+
+const (
+	// errorRateWeight is weight of last call result in error rate
+	errorRateWeight = 0.1
+
+	breakerClosed   = "closed"
+	breakerOpen     = "open"
+	breakerHalfOpen = "half-open"
+)
+
+// newPool is constructor for pool, it uses single endpoint from config if list is empty
+func newPool(c *config.BlockchainConfig, log *logger.Logger) *pool {
+	endpointConfigs := c.Endpoints
+	if len(endpointConfigs) == 0 {
+		endpointConfigs = []*config.EndpointConfig{{IP: c.IP, Port: c.Port, WSPort: c.WSPort, Weight: 1}}
+	}
+
+	p := &pool{config: c, stop: make(chan struct{}), log: log}
+	for _, ec := range endpointConfigs {
+		ep := &endpoint{config: ec, healthy: true}
+		p.endpoints = append(p.endpoints, ep)
+
+		metrics.Set(breakerMetric+ep.url(), expvar.Func(func() interface{} {
+			return p.breakerState(ep)
+		}))
+	}
+
+	return p
+}
+
+// connect dials all endpoints, checks their network, makes first health check and starts periodic ones
+func (p *pool) connect(ctx context.Context) error {
+	for _, ep := range p.endpoints {
+		var err error
+		if ep.rpc, err = rpc.DialContext(ctx, ep.url()); err != nil {
+			return fmt.Errorf("error while connecting to RPC `%s`: %v", ep.url(), err)
+		}
+
+		if err = p.verify(ctx, ep); err != nil {
+			return err
+		}
+	}
+
+	p.checkHealth()
+	if p.config.HealthInterval > 0 {
+		go func() {
+			tcr := time.NewTicker(p.config.HealthInterval)
+			defer tcr.Stop()
+			for {
+				select {
+				case <-tcr.C:
+					p.checkHealth()
+				case <-p.stop:
+					return
+				}
+			}
+		}()
+	}
+
+	return nil
+}
+
+// call makes RPC call through healthy endpoints and fails over to next one
+// if endpoint is unreachable or doesn't answer in time of method's timeout.
+// Errors returned by node itself are not retried
+func (p *pool) call(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	return p.retry(ctx, method, func(ctx context.Context, ep *endpoint) error {
+		return ep.rpc.CallContext(ctx, result, method, args...)
+	})
+}
+
+// batchCall sends several calls in one request with the same failover as call
+func (p *pool) batchCall(ctx context.Context, batch []rpc.BatchElem) error {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	return p.retry(ctx, batch[0].Method, func(ctx context.Context, ep *endpoint) error {
+		return ep.rpc.BatchCallContext(ctx, batch)
+	})
+}
+
+// try runs request on healthy endpoints one by one until it succeeds, node returns error
+// or context is done. Each attempt is limited by default timeout of method.
+// Calls that failed on all endpoints are repeated by retry policy
+func (p *pool) try(ctx context.Context, method string, request func(context.Context, *endpoint) error) error {
+	// Error stays if there are no endpoints, or all of them are skipped by breakers
+	err := fmt.Errorf("no healthy RPC endpoints")
+	for _, ep := range p.candidates() {
+		if !p.startCall(ep) {
+			continue
+		}
+
+		attemptCtx, cancel := p.withTimeout(ctx, method)
+		err = request(attemptCtx, ep)
+		cancel()
+
+		// Cancellation by caller is not failure of endpoint
+		if ctx.Err() != nil {
+			p.endTrial(ep)
+			return ctx.Err()
+		}
+		ep.record(err)
+		p.countInBreaker(ep, err)
+
+		if _, isNodeErr := err.(rpc.Error); err == nil || isNodeErr {
+			return err
+		}
+	}
+
+	return err
+}
+
+// withTimeout limits context by default timeout of method, closer deadline of context stays
+func (p *pool) withTimeout(ctx context.Context, method string) (context.Context, context.CancelFunc) {
+	if timeout := p.timeout(method); timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+
+	return context.WithCancel(ctx)
+}
+
+// timeout returns default timeout of method from config, zero means unlimited
+func (p *pool) timeout(method string) time.Duration {
+	c := p.config.Timeouts
+	if c == nil {
+		return 0
+	}
+
+	var timeout time.Duration
+	switch method {
+	case sendRawTransactionMethod:
+		timeout = c.Send
+	case estimateGasMethod, gasPriceMethod, feeHistoryMethod, maxPriorityFeePerGasMethod:
+		timeout = c.Estimate
+	case getBalanceMethod, callMethod:
+		timeout = c.Balance
+	case getBlockByNumberMethod, getTransactionByHashMethod, getReceiptMethod:
+		timeout = c.Block
+	}
+
+	if timeout <= 0 {
+		timeout = c.Default
+	}
+
+	return timeout
+}
+
+// candidates returns healthy endpoints with passing breakers in weighted random order
+func (p *pool) candidates() []*endpoint {
+	var healthy []*endpoint
+	var keys = make(map[*endpoint]float64)
+	for _, ep := range p.endpoints {
+		if !ep.isHealthy() || p.breakerState(ep) == breakerOpen {
+			continue
+		}
+
+		weight := ep.config.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		// Weighted random sampling: bigger weight gives bigger key more often
+		keys[ep] = -rand.ExpFloat64() / float64(weight)
+		healthy = append(healthy, ep)
+	}
+
+	sort.Slice(healthy, func(i, j int) bool { return keys[healthy[i]] > keys[healthy[j]] })
+
+	return healthy
+}
+
+// wsEndpoint returns healthy endpoint with websocket support
+func (p *pool) wsEndpoint() (*endpoint, error) {
+	for _, ep := range p.candidates() {
+		if ep.config.WSPort != 0 {
+			return ep, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no healthy endpoints with websocket")
+}
+
+// hasWS checks that at least one endpoint has websocket
+func (p *pool) hasWS() bool {
+	for _, ep := range p.endpoints {
+		if ep.config.WSPort != 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// verify checks network of endpoint
+func (p *pool) verify(ctx context.Context, ep *endpoint) error {
+	ctx, cancel := p.withTimeout(ctx, chainIDMethod)
+	defer cancel()
+
+	if err := verifyChain(ctx, ep.rpc, p.config); err != nil {
+		return fmt.Errorf("wrong network of RPC `%s`: %v", ep.url(), err)
+	}
+
+	return nil
+}
+
+// checkHealth probes all endpoints and marks as unhealthy those, that are lagging,
+// slow or failing too often. Network of recovered endpoints is checked again,
+// as node could be replaced while it was unavailable
+func (p *pool) checkHealth() {
+	var wg sync.WaitGroup
+	for _, ep := range p.endpoints {
+		wg.Add(1)
+		go func(ep *endpoint) {
+			defer wg.Done()
+
+			ctx, cancel := p.withTimeout(context.Background(), getCurrentBlockMethod)
+			defer cancel()
+			ep.probe(ctx)
+		}(ep)
+	}
+	wg.Wait()
+
+	var maxHeight int64
+	for _, ep := range p.endpoints {
+		if h := ep.getHeight(); h > maxHeight {
+			maxHeight = h
+		}
+	}
+
+	for _, ep := range p.endpoints {
+		ep.Lock()
+		wasHealthy := ep.healthy
+		// Height is not checked by itself, chain of new network is at block 0
+		healthy := ep.reachable &&
+			(p.config.MaxBlockLag <= 0 || maxHeight-ep.height <= p.config.MaxBlockLag) &&
+			(p.config.MaxLatency <= 0 || ep.latency <= p.config.MaxLatency) &&
+			(p.config.MaxErrorRate <= 0 || ep.errorRate <= p.config.MaxErrorRate)
+		ep.Unlock()
+
+		if healthy && !wasHealthy {
+			if err := p.verify(context.Background(), ep); err != nil {
+				p.log.Errorw("recovered RPC endpoint is not used", "endpoint", ep.url(), "error", err)
+				healthy = false
+			}
+		}
+
+		ep.Lock()
+		ep.healthy = healthy
+		ep.Unlock()
+	}
+}
+
+// breakerState returns state of endpoint's circuit breaker. Open breaker becomes half-open
+// after cooldown and passes one trial call, its result closes breaker or opens it again
+func (p *pool) breakerState(ep *endpoint) string {
+	ep.RLock()
+	defer ep.RUnlock()
+
+	switch {
+	case ep.openedAt.IsZero():
+		return breakerClosed
+	case time.Since(ep.openedAt) < p.config.Breaker.Cooldown:
+		return breakerOpen
+	default:
+		return breakerHalfOpen
+	}
+}
+
+// startCall checks that breaker of endpoint passes call. Half-open breaker passes only one trial call,
+// other calls skip endpoint until its result
+func (p *pool) startCall(ep *endpoint) bool {
+	switch p.breakerState(ep) {
+	case breakerClosed:
+		return true
+	case breakerOpen:
+		return false
+	}
+
+	ep.Lock()
+	defer ep.Unlock()
+	if ep.trial {
+		return false
+	}
+	ep.trial = true
+
+	return true
+}
+
+// endTrial lets half-open breaker pass next trial call, when current one has no result
+func (p *pool) endTrial(ep *endpoint) {
+	ep.Lock()
+	ep.trial = false
+	ep.Unlock()
+}
+
+// countInBreaker opens breaker of endpoint after several failures in a row or failed trial call,
+// and closes it after successful call. Errors returned by node itself are not failures of endpoint
+func (p *pool) countInBreaker(ep *endpoint, err error) {
+	c := p.config.Breaker
+	if c == nil || c.Failures <= 0 {
+		return
+	}
+
+	_, isNodeErr := err.(rpc.Error)
+	failed := err != nil && !isNodeErr
+	prevState := p.breakerState(ep)
+
+	ep.Lock()
+	ep.trial = false
+	if failed {
+		ep.failures++
+		if ep.failures >= c.Failures || !ep.openedAt.IsZero() {
+			ep.openedAt = time.Now()
+		}
+	} else {
+		ep.failures = 0
+		ep.openedAt = time.Time{}
+	}
+	failures := ep.failures
+	ep.Unlock()
+
+	switch state := p.breakerState(ep); {
+	case state == breakerOpen && prevState != breakerOpen:
+		p.log.Warnw("circuit breaker of RPC endpoint is open", "endpoint", ep.url(), "failures", failures, "error", err)
+	case state == breakerClosed && prevState != breakerClosed:
+		p.log.Infow("circuit breaker of RPC endpoint is closed", "endpoint", ep.url())
+	}
+}
+
+func (p *pool) close() {
+	close(p.stop)
+	for _, ep := range p.endpoints {
+		if ep.rpc != nil {
+			ep.rpc.Close()
+		}
+	}
+}
+
+// probe gets block height of endpoint and measures latency
+func (ep *endpoint) probe(ctx context.Context) {
+	var heightHex string
+	start := time.Now()
+	err := ep.rpc.CallContext(ctx, &heightHex, getCurrentBlockMethod)
+	latency := time.Since(start)
+	ep.record(err)
+
+	var height int64
+	reachable := err == nil
+	if reachable {
+		if h, ok := helper.HexToBig(heightHex); ok {
+			height = h.Int64()
+		} else {
+			reachable = false
+		}
+	}
+
+	ep.Lock()
+	ep.height = height
+	ep.reachable = reachable
+	ep.latency = latency
+	ep.Unlock()
+}
+
+// record saves result of call in error rate
+func (ep *endpoint) record(err error) {
+	var failed float64
+	if _, isNodeErr := err.(rpc.Error); err != nil && !isNodeErr {
+		failed = 1
+	}
+
+	ep.Lock()
+	ep.errorRate = ep.errorRate*(1-errorRateWeight) + failed*errorRateWeight
+	ep.Unlock()
+}
+
+func (ep *endpoint) isHealthy() bool {
+	ep.RLock()
+	defer ep.RUnlock()
+
+	return ep.healthy
+}
+
+func (ep *endpoint) getHeight() int64 {
+	ep.RLock()
+	defer ep.RUnlock()
+
+	return ep.height
+}
+
+func (ep *endpoint) url() string {
+	return fmt.Sprintf("http://%s:%d", ep.config.IP, ep.config.Port)
+}
+
+func (ep *endpoint) wsURL() string {
+	return fmt.Sprintf("ws://%s:%d", ep.config.IP, ep.config.WSPort)
+}
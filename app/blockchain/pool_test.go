@@ -0,0 +1,226 @@
+package blockchain
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/kainobor/eth-client/app/config"
+	"github.com/kainobor/eth-client/app/helper"
+	"github.com/kainobor/eth-client/app/logger"
+	"go.uber.org/zap"
+)
+
+// HealthNode is eth and net namespaces of node, that is probed by pool
+type HealthNode struct {
+	height  int64
+	delay   time.Duration
+	chainID int64
+	err     error
+}
+
+func (n *HealthNode) BlockNumber() (string, error) {
+	time.Sleep(n.delay)
+
+	return helper.BigToHex(*big.NewInt(n.height)), n.err
+}
+
+func (n *HealthNode) ChainId() (string, error) {
+	return helper.BigToHex(*big.NewInt(n.chainID)), nil
+}
+
+func (n *HealthNode) Version() (string, error) {
+	return "1", nil
+}
+
+func TestCheckHealth(t *testing.T) {
+	tests := []struct {
+		name      string
+		node      *HealthNode
+		errorRate float64 // Error rate before probe
+		unhealthy bool    // Endpoint is unhealthy before probe
+		healthy   bool
+	}{
+		{name: "the highest", node: &HealthNode{height: 100, chainID: 1}, healthy: true},
+		{name: "lagging within limit", node: &HealthNode{height: 95, chainID: 1}, healthy: true},
+		{name: "lagging", node: &HealthNode{height: 94, chainID: 1}},
+		{name: "slow", node: &HealthNode{height: 100, chainID: 1, delay: 100 * time.Millisecond}},
+		{name: "failing often", node: &HealthNode{height: 100, chainID: 1}, errorRate: 0.9},
+		{name: "unreachable", node: &HealthNode{height: 100, chainID: 1, err: errors.New("node is syncing")}},
+		{name: "recovered", node: &HealthNode{height: 100, chainID: 1}, unhealthy: true, healthy: true},
+		{name: "recovered in other network", node: &HealthNode{height: 100, chainID: 5}, unhealthy: true},
+	}
+
+	var eps []*endpoint
+	for _, tt := range tests {
+		ep := newTestEndpoint(t, tt.node)
+		ep.errorRate = tt.errorRate
+		ep.healthy = !tt.unhealthy
+		eps = append(eps, ep)
+	}
+	p := newTestPool(&config.BlockchainConfig{ChainID: 1, MaxBlockLag: 5, MaxLatency: 50 * time.Millisecond, MaxErrorRate: 0.5}, eps...)
+
+	p.checkHealth()
+	for i, tt := range tests {
+		if eps[i].isHealthy() != tt.healthy {
+			t.Errorf("%s: expected healthy %t, got %t", tt.name, tt.healthy, eps[i].isHealthy())
+		}
+	}
+}
+
+func TestCheckHealthWithoutLimits(t *testing.T) {
+	// New network is at block 0, and nothing is limited except reachability
+	eps := []*endpoint{
+		newTestEndpoint(t, &HealthNode{chainID: 1, delay: 20 * time.Millisecond}),
+		newTestEndpoint(t, &HealthNode{height: 1000, chainID: 1}),
+		newTestEndpoint(t, &HealthNode{chainID: 1, err: errors.New("node is down")}),
+	}
+	eps[0].errorRate = 1
+	p := newTestPool(&config.BlockchainConfig{ChainID: 1}, eps...)
+
+	p.checkHealth()
+	if !eps[0].isHealthy() || !eps[1].isHealthy() || eps[2].isHealthy() {
+		t.Errorf("expected only reachable endpoints to be healthy, got %t, %t, %t", eps[0].isHealthy(), eps[1].isHealthy(), eps[2].isHealthy())
+	}
+}
+
+func TestCandidates(t *testing.T) {
+	light := &endpoint{config: &config.EndpointConfig{IP: "light", Weight: 1}, healthy: true}
+	heavy := &endpoint{config: &config.EndpointConfig{IP: "heavy", Weight: 9}, healthy: true}
+	unhealthy := &endpoint{config: &config.EndpointConfig{IP: "unhealthy", Weight: 100}}
+	p := newTestPool(&config.BlockchainConfig{}, light, heavy, unhealthy)
+
+	var heavyFirst int
+	for i := 0; i < 1000; i++ {
+		candidates := p.candidates()
+		if len(candidates) != 2 {
+			t.Fatalf("expected only healthy endpoints, got %d", len(candidates))
+		}
+		if candidates[0] == heavy {
+			heavyFirst++
+		}
+	}
+
+	// Heavy endpoint is the first one in 90% of calls
+	if heavyFirst < 800 || heavyFirst > 980 {
+		t.Errorf("expected heavy endpoint first in about 900 calls, got %d", heavyFirst)
+	}
+}
+
+func TestTryFailsOver(t *testing.T) {
+	down := newTestEndpoint(t, &HealthNode{})
+	down.rpc.Close()
+	p := newTestPool(&config.BlockchainConfig{}, down, newTestEndpoint(t, &HealthNode{height: 7}))
+
+	// Order is random, so the closed endpoint is tried first in some of calls
+	for i := 0; i < 10; i++ {
+		var heightHex string
+		if err := p.call(context.Background(), &heightHex, getCurrentBlockMethod); err != nil {
+			t.Fatal(err)
+		}
+		if heightHex != "0x7" {
+			t.Fatalf("expected height of working endpoint, got %s", heightHex)
+		}
+	}
+
+	p.endpoints[1].healthy = false
+	if err := p.call(context.Background(), nil, getCurrentBlockMethod); err == nil {
+		t.Error("expected error without working endpoints")
+	}
+	p.endpoints[0].healthy = false
+	if err := p.call(context.Background(), nil, getCurrentBlockMethod); err == nil || err.Error() != "no healthy RPC endpoints" {
+		t.Errorf("expected error of no healthy endpoints, got %v", err)
+	}
+}
+
+func newTestPool(c *config.BlockchainConfig, eps ...*endpoint) *pool {
+	return &pool{config: c, endpoints: eps, stop: make(chan struct{}), log: &logger.Logger{SugaredLogger: zap.NewNop().Sugar()}}
+}
+
+// newTestEndpoint returns healthy endpoint, which calls go to node in memory
+func newTestEndpoint(t *testing.T, node *HealthNode) *endpoint {
+	server := rpc.NewServer()
+	for _, namespace := range []string{"eth", "net"} {
+		if err := server.RegisterName(namespace, node); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(server.Stop)
+
+	return &endpoint{config: &config.EndpointConfig{IP: "127.0.0.1"}, rpc: rpc.DialInProc(server), healthy: true}
+}
+
+func TestBreaker(t *testing.T) {
+	const cooldown = time.Minute
+	ep := &endpoint{config: &config.EndpointConfig{}, healthy: true}
+	p := newTestPool(&config.BlockchainConfig{Breaker: &config.BreakerConfig{Failures: 2, Cooldown: cooldown}}, ep)
+	checkState := func(expected string) {
+		t.Helper()
+		if state := p.breakerState(ep); state != expected {
+			t.Fatalf("expected %s breaker, got %s", expected, state)
+		}
+	}
+	// cool lets cooldown of open breaker pass
+	cool := func() {
+		ep.Lock()
+		ep.openedAt = time.Now().Add(-cooldown)
+		ep.Unlock()
+	}
+
+	// Errors of node itself are not failures of endpoint
+	p.countInBreaker(ep, errors.New("connection refused"))
+	p.countInBreaker(ep, testNodeError{code: -32000})
+	p.countInBreaker(ep, errors.New("connection refused"))
+	checkState(breakerClosed)
+
+	p.countInBreaker(ep, errors.New("connection refused"))
+	checkState(breakerOpen)
+	if p.startCall(ep) || len(p.candidates()) != 0 {
+		t.Fatal("open breaker passes calls")
+	}
+
+	// Half-open breaker passes only one trial, failed trial opens it again
+	cool()
+	checkState(breakerHalfOpen)
+	if !p.startCall(ep) || p.startCall(ep) {
+		t.Fatal("expected only one trial call of half-open breaker")
+	}
+	p.countInBreaker(ep, errors.New("timeout"))
+	checkState(breakerOpen)
+
+	// Trial without result lets next one pass
+	cool()
+	if !p.startCall(ep) {
+		t.Fatal("half-open breaker doesn't pass trial call")
+	}
+	p.endTrial(ep)
+	if !p.startCall(ep) {
+		t.Fatal("half-open breaker doesn't pass trial call after cancelled one")
+	}
+
+	p.countInBreaker(ep, nil)
+	checkState(breakerClosed)
+	if !p.startCall(ep) || !p.startCall(ep) {
+		t.Fatal("closed breaker doesn't pass calls")
+	}
+}
+
+func TestBreakerTrialOfCancelledCall(t *testing.T) {
+	ep := newTestEndpoint(t, &HealthNode{delay: time.Second})
+	p := newTestPool(&config.BlockchainConfig{Breaker: &config.BreakerConfig{Failures: 1, Cooldown: time.Minute}}, ep)
+	ep.openedAt = time.Now().Add(-time.Minute)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := p.call(ctx, nil, getCurrentBlockMethod); err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline error, got %v", err)
+	}
+
+	// Cancellation by caller neither opens nor closes breaker
+	if state := p.breakerState(ep); state != breakerHalfOpen || !p.startCall(ep) {
+		t.Errorf("expected half-open breaker with free trial, got %s", state)
+	}
+}
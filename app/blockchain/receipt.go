@@ -0,0 +1,107 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/kainobor/eth-client/app/helper"
+)
+
+type (
+	// Receipt represents result of transaction execution
+	Receipt struct {
+		success           bool
+		statusKnown       bool // Status is absent in receipts before Byzantium and of some L2 nodes
+		gasUsed           uint64
+		effectiveGasPrice big.Int
+		contractAddress   string
+		blockHash         string
+		blockNumber       big.Int
+	}
+)
+
+const (
+	receiptSuccessStatus = "0x1"
+)
+
+// UnmarshalJSON implements the json.Unmarshaler interface
+func (r *Receipt) UnmarshalJSON(data []byte) error {
+	params := struct {
+		Status            string  `json:"status"`
+		GasUsed           string  `json:"gasUsed"`
+		EffectiveGasPrice string  `json:"effectiveGasPrice"`
+		ContractAddress   *string `json:"contractAddress"`
+		BlockHash         string  `json:"blockHash"`
+		BlockNumber       string  `json:"blockNumber"`
+	}{}
+
+	if err := json.Unmarshal(data, &params); err != nil {
+		return fmt.Errorf("error while unmarshaling receipt: %v", err)
+	}
+
+	var ok bool
+	if r.gasUsed, ok = helper.HexToUint64(params.GasUsed); !ok {
+		return fmt.Errorf("wrong gas used: %s", params.GasUsed)
+	}
+
+	// Old nodes don't return effective gas price
+	if params.EffectiveGasPrice != "" {
+		price, ok := helper.HexToBig(params.EffectiveGasPrice)
+		if !ok {
+			return fmt.Errorf("wrong effective gas price: %s", params.EffectiveGasPrice)
+		}
+		r.effectiveGasPrice = *price
+	}
+
+	blockNumber, ok := helper.HexToBig(params.BlockNumber)
+	if !ok {
+		return fmt.Errorf("wrong block number: %s", params.BlockNumber)
+	}
+	r.blockNumber = *blockNumber
+
+	// Transaction without status is mined, and there is no reliable way to know that it was reverted
+	r.statusKnown = params.Status != ""
+	r.success = !r.statusKnown || params.Status == receiptSuccessStatus
+	r.blockHash = params.BlockHash
+	if params.ContractAddress != nil {
+		r.contractAddress = *params.ContractAddress
+	}
+
+	return nil
+}
+
+// Success is getter, false means that transaction was reverted
+func (r *Receipt) Success() bool {
+	return r.success
+}
+
+// StatusKnown is getter, false means that node returned no status and transaction is treated as successful
+func (r *Receipt) StatusKnown() bool {
+	return r.statusKnown
+}
+
+// GasUsed is getter
+func (r *Receipt) GasUsed() uint64 {
+	return r.gasUsed
+}
+
+// EffectiveGasPrice is getter
+func (r *Receipt) EffectiveGasPrice() big.Int {
+	return r.effectiveGasPrice
+}
+
+// ContractAddress is getter
+func (r *Receipt) ContractAddress() string {
+	return r.contractAddress
+}
+
+// BlockHash is getter
+func (r *Receipt) BlockHash() string {
+	return r.blockHash
+}
+
+// BlockNumber is getter
+func (r *Receipt) BlockNumber() big.Int {
+	return r.blockNumber
+}
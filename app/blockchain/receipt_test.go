@@ -0,0 +1,71 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestUnmarshalReceipt(t *testing.T) {
+	tests := []struct {
+		name        string
+		json        string
+		success     bool
+		statusKnown bool
+		fail        bool
+	}{
+		{
+			name:    "success",
+			json:    `{"status":"0x1","gasUsed":"0x5208","effectiveGasPrice":"0x3b9aca00","contractAddress":null,"blockHash":"0xab","blockNumber":"0x10"}`,
+			success: true, statusKnown: true,
+		},
+		{
+			name:        "reverted",
+			json:        `{"status":"0x0","gasUsed":"0x5208","blockHash":"0xab","blockNumber":"0x10"}`,
+			statusKnown: true,
+		},
+		{
+			name:    "without status",
+			json:    `{"root":"0x01","gasUsed":"0x5208","blockHash":"0xab","blockNumber":"0x10"}`,
+			success: true,
+		},
+		{name: "wrong gas used", json: `{"status":"0x1","gasUsed":"","blockNumber":"0x10"}`, fail: true},
+		{name: "wrong gas price", json: `{"status":"0x1","gasUsed":"0x1","effectiveGasPrice":"gwei","blockNumber":"0x10"}`, fail: true},
+		{name: "wrong block number", json: `{"status":"0x1","gasUsed":"0x1"}`, fail: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r Receipt
+			err := json.Unmarshal([]byte(tt.json), &r)
+			if tt.fail {
+				if err == nil {
+					t.Error("expected error of wrong receipt")
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if r.Success() != tt.success || r.StatusKnown() != tt.statusKnown {
+				t.Errorf("expected success %t and known status %t, got %t and %t", tt.success, tt.statusKnown, r.Success(), r.StatusKnown())
+			}
+			number := r.BlockNumber()
+			if r.GasUsed() != 21000 || r.BlockHash() != "0xab" || number.Int64() != 16 {
+				t.Errorf("wrong gas used, block hash or number: %d, %s, %s", r.GasUsed(), r.BlockHash(), number.String())
+			}
+		})
+	}
+}
+
+func TestUnmarshalReceiptOfContractCreation(t *testing.T) {
+	var r Receipt
+	data := `{"status":"0x1","gasUsed":"0x1","effectiveGasPrice":"0x3b9aca00","contractAddress":"0xdac17f958d2ee523a2206206994597c13d831ec7","blockNumber":"0x1"}`
+	if err := json.Unmarshal([]byte(data), &r); err != nil {
+		t.Fatal(err)
+	}
+
+	price := r.EffectiveGasPrice()
+	if r.ContractAddress() != "0xdac17f958d2ee523a2206206994597c13d831ec7" || price.Int64() != 1000000000 {
+		t.Errorf("wrong contract address or gas price: %s, %s", r.ContractAddress(), price.String())
+	}
+}
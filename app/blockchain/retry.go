@@ -0,0 +1,137 @@
+package blockchain
+
+import (
+	"context"
+	"expvar"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+type (
+	// retryPolicy describes how RPC call with transient error is repeated
+	retryPolicy struct {
+		attempts   int
+		minBackoff time.Duration
+		maxBackoff time.Duration
+	}
+)
+
+const (
+	limitExceededErrorCode = -32005
+	internalErrorCode      = -32603
+
+	callsMetric    = "calls."
+	retriesMetric  = "retries."
+	failuresMetric = "failures."
+	breakerMetric  = "breaker."
+)
+
+var (
+	// metrics of RPC calls and endpoints, published on /debug/vars
+	metrics = expvar.NewMap("rpc")
+
+	// transientNodeMessages are parts of node errors, that depend on node state and may pass on retry
+	transientNodeMessages = []string{"header not found", "too many requests"}
+)
+
+// retry repeats request with growing pauses while it fails with transient errors
+func (p *pool) retry(ctx context.Context, method string, request func(context.Context, *endpoint) error) error {
+	policy := p.retryPolicy(method)
+	metrics.Add(callsMetric+method, 1)
+
+	var err error
+	for attempt := 0; attempt < policy.attempts; attempt++ {
+		if attempt > 0 {
+			metrics.Add(retriesMetric+method, 1)
+
+			select {
+			case <-time.After(policy.backoff(attempt)):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		if err = p.try(ctx, method, request); !isRetryable(err) || ctx.Err() != nil {
+			break
+		}
+	}
+
+	if err != nil {
+		metrics.Add(failuresMetric+method, 1)
+	}
+
+	return err
+}
+
+// retryPolicy returns policy of method, or default one if method has no own policy
+func (p *pool) retryPolicy(method string) retryPolicy {
+	c := p.config.Retry
+	for _, mc := range p.config.MethodRetries {
+		if mc.Method == method {
+			c = mc
+			break
+		}
+	}
+
+	policy := retryPolicy{attempts: 1}
+	if c == nil {
+		return policy
+	}
+
+	if c.Attempts > 1 {
+		policy.attempts = c.Attempts
+	}
+	policy.minBackoff = c.MinBackoff
+	policy.maxBackoff = c.MaxBackoff
+	if policy.maxBackoff < policy.minBackoff {
+		policy.maxBackoff = policy.minBackoff
+	}
+
+	return policy
+}
+
+// backoff returns pause before retry with some number. Pause is doubled on each retry,
+// and its half is random, so clients that failed together don't retry together
+func (rp retryPolicy) backoff(attempt int) time.Duration {
+	backoff := rp.minBackoff << uint(attempt-1)
+	if backoff > rp.maxBackoff || backoff <= 0 {
+		backoff = rp.maxBackoff
+	}
+
+	half := int64(backoff / 2)
+	if half <= 0 {
+		return backoff
+	}
+
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
+// isRetryable checks that call failed because of network or node state, not because of request itself
+func isRetryable(err error) bool {
+	if err == nil || err == context.Canceled {
+		return false
+	}
+
+	nodeErr, ok := err.(rpc.Error)
+	if !ok {
+		// Transport errors, timeouts and lack of healthy endpoints
+		return true
+	}
+
+	switch nodeErr.ErrorCode() {
+	case limitExceededErrorCode, internalErrorCode:
+		return true
+	}
+
+	msg := strings.ToLower(err.Error())
+	for _, transient := range transientNodeMessages {
+		if strings.Contains(msg, transient) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,128 @@
+package blockchain
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kainobor/eth-client/app/config"
+)
+
+// testNodeError is error returned by node itself
+type testNodeError struct {
+	code int
+	msg  string
+}
+
+func (e testNodeError) Error() string  { return e.msg }
+func (e testNodeError) ErrorCode() int { return e.code }
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		err       error
+		retryable bool
+	}{
+		{err: nil},
+		{err: context.Canceled},
+		{err: context.DeadlineExceeded, retryable: true},
+		{err: errors.New("connection refused"), retryable: true},
+		{err: testNodeError{code: limitExceededErrorCode, msg: "limit exceeded"}, retryable: true},
+		{err: testNodeError{code: internalErrorCode, msg: "internal error"}, retryable: true},
+		{err: testNodeError{code: -32000, msg: "Header not found"}, retryable: true},
+		{err: testNodeError{code: -32000, msg: "too many requests, slow down"}, retryable: true},
+		{err: testNodeError{code: -32000, msg: "nonce too low"}},
+		{err: testNodeError{code: methodNotFoundErrorCode, msg: "method not found"}},
+	}
+
+	for _, tt := range tests {
+		if retryable := isRetryable(tt.err); retryable != tt.retryable {
+			t.Errorf("%v: expected retryable %t, got %t", tt.err, tt.retryable, retryable)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	policy := retryPolicy{attempts: 100, minBackoff: 100 * time.Millisecond, maxBackoff: time.Second}
+	tests := []struct {
+		attempt  int
+		min, max time.Duration
+	}{
+		{attempt: 1, min: 50 * time.Millisecond, max: 100 * time.Millisecond},
+		{attempt: 2, min: 100 * time.Millisecond, max: 200 * time.Millisecond},
+		{attempt: 4, min: 400 * time.Millisecond, max: 800 * time.Millisecond},
+		{attempt: 5, min: 500 * time.Millisecond, max: time.Second},
+		// Shift overflows duration
+		{attempt: 64, min: 500 * time.Millisecond, max: time.Second},
+	}
+
+	for _, tt := range tests {
+		for i := 0; i < 100; i++ {
+			if backoff := policy.backoff(tt.attempt); backoff < tt.min || backoff > tt.max {
+				t.Fatalf("attempt %d: backoff %s is out of [%s, %s]", tt.attempt, backoff, tt.min, tt.max)
+			}
+		}
+	}
+
+	if backoff := (retryPolicy{}).backoff(3); backoff != 0 {
+		t.Errorf("expected no backoff without config, got %s", backoff)
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	p := newTestPool(&config.BlockchainConfig{
+		Retry:         &config.RetryConfig{Attempts: 3, MinBackoff: time.Second, MaxBackoff: time.Millisecond},
+		MethodRetries: []*config.RetryConfig{{Method: sendRawTransactionMethod, Attempts: 0}},
+	})
+
+	expected := retryPolicy{attempts: 3, minBackoff: time.Second, maxBackoff: time.Second}
+	if policy := p.retryPolicy(getBalanceMethod); policy != expected {
+		t.Errorf("expected default policy %+v, got %+v", expected, policy)
+	}
+	if policy := p.retryPolicy(sendRawTransactionMethod); policy.attempts != 1 {
+		t.Errorf("expected only one attempt of sending, got %d", policy.attempts)
+	}
+	if policy := newTestPool(&config.BlockchainConfig{}).retryPolicy(getBalanceMethod); policy.attempts != 1 {
+		t.Errorf("expected one attempt without config, got %d", policy.attempts)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		attempts int
+	}{
+		{name: "transient error", err: errors.New("connection refused"), attempts: 3},
+		{name: "error of request", err: testNodeError{code: -32000, msg: "insufficient funds"}, attempts: 1},
+		{name: "success", attempts: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestPool(&config.BlockchainConfig{Retry: &config.RetryConfig{Attempts: 3, MinBackoff: time.Millisecond}},
+				&endpoint{config: &config.EndpointConfig{}, healthy: true})
+
+			var attempts int
+			err := p.retry(context.Background(), getBalanceMethod, func(ctx context.Context, ep *endpoint) error {
+				attempts++
+				return tt.err
+			})
+			if err != tt.err || attempts != tt.attempts {
+				t.Errorf("expected %d attempts and error %v, got %d and %v", tt.attempts, tt.err, attempts, err)
+			}
+		})
+	}
+
+	// Retry is not waited after cancellation
+	p := newTestPool(&config.BlockchainConfig{Retry: &config.RetryConfig{Attempts: 3, MinBackoff: time.Hour}},
+		&endpoint{config: &config.EndpointConfig{}, healthy: true})
+	ctx, cancel := context.WithCancel(context.Background())
+	err := p.retry(ctx, getBalanceMethod, func(context.Context, *endpoint) error {
+		cancel()
+		return errors.New("connection refused")
+	})
+	if err != context.Canceled {
+		t.Errorf("expected cancellation, got %v", err)
+	}
+}
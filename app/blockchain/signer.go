@@ -0,0 +1,196 @@
+package blockchain
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/kainobor/eth-client/app/config"
+	"github.com/kainobor/eth-client/app/helper"
+)
+
+const dynamicFeeTxType = 0x02
+
+type (
+	// Signer signs transactions locally with private keys from configured sources
+	Signer struct {
+		chainID *big.Int
+		keys    map[string]*ecdsa.PrivateKey
+	}
+)
+
+// NewSigner loads private keys from files and environment variable mentioned in config
+func NewSigner(c *config.BlockchainConfig) (*Signer, error) {
+	s := &Signer{chainID: big.NewInt(c.ChainID), keys: make(map[string]*ecdsa.PrivateKey)}
+
+	for _, path := range c.KeyFiles {
+		if err := s.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.KeysEnv != "" {
+		for _, hexKey := range strings.Split(os.Getenv(c.KeysEnv), ",") {
+			if err := s.addKey(hexKey); err != nil {
+				return nil, fmt.Errorf("wrong key in `%s` environment variable: %v", c.KeysEnv, err)
+			}
+		}
+	}
+
+	return s, nil
+}
+
+// CanSign checks that signer has private key for address
+func (s *Signer) CanSign(addr string) bool {
+	_, ok := s.keys[normalizeAddress(addr)]
+
+	return ok
+}
+
+// Sign encodes transaction with RLP, signs it with sender's key
+// and saves raw result in transaction
+func (s *Signer) Sign(t *Transaction) error {
+	key, ok := s.keys[normalizeAddress(t.From())]
+	if !ok {
+		return fmt.Errorf("no private key for address `%s`", t.From())
+	}
+
+	if t.IsDynamicFee() {
+		return s.signDynamicFee(t, key)
+	}
+
+	return s.signLegacy(t, key)
+}
+
+// signLegacy signs transaction with replay protection of EIP-155
+func (s *Signer) signLegacy(t *Transaction, key *ecdsa.PrivateKey) error {
+	fields := s.legacyFields(t)
+	unsigned, err := rlp.EncodeToBytes(append(fields, s.chainID, uint(0), uint(0)))
+	if err != nil {
+		return fmt.Errorf("can't encode transaction: %v", err)
+	}
+
+	sig, err := crypto.Sign(crypto.Keccak256(unsigned), key)
+	if err != nil {
+		return fmt.Errorf("can't sign transaction: %v", err)
+	}
+
+	v := new(big.Int).Mul(s.chainID, big.NewInt(2))
+	v.Add(v, big.NewInt(int64(sig[64])+35))
+	r := new(big.Int).SetBytes(sig[:32])
+	sv := new(big.Int).SetBytes(sig[32:64])
+
+	raw, err := rlp.EncodeToBytes(append(fields, v, r, sv))
+	if err != nil {
+		return fmt.Errorf("can't encode signed transaction: %v", err)
+	}
+
+	t.SetRaw(raw)
+
+	return nil
+}
+
+// signDynamicFee signs typed transaction of EIP-1559
+func (s *Signer) signDynamicFee(t *Transaction, key *ecdsa.PrivateKey) error {
+	fields := s.dynamicFeeFields(t)
+	unsigned, err := rlp.EncodeToBytes(fields)
+	if err != nil {
+		return fmt.Errorf("can't encode transaction: %v", err)
+	}
+
+	sig, err := crypto.Sign(crypto.Keccak256([]byte{dynamicFeeTxType}, unsigned), key)
+	if err != nil {
+		return fmt.Errorf("can't sign transaction: %v", err)
+	}
+
+	r := new(big.Int).SetBytes(sig[:32])
+	sv := new(big.Int).SetBytes(sig[32:64])
+
+	signed, err := rlp.EncodeToBytes(append(fields, uint(sig[64]), r, sv))
+	if err != nil {
+		return fmt.Errorf("can't encode signed transaction: %v", err)
+	}
+
+	t.SetRaw(append([]byte{dynamicFeeTxType}, signed...))
+
+	return nil
+}
+
+// dynamicFeeFields returns EIP-1559 transaction fields in order of RLP encoding
+func (s *Signer) dynamicFeeFields(t *Transaction) []interface{} {
+	maxTip := t.MaxPriorityFeePerGas()
+	maxFee := t.MaxFeePerGas()
+	value := t.Value()
+
+	return []interface{}{
+		s.chainID,
+		t.Nonce(),
+		&maxTip,
+		&maxFee,
+		t.Gas(),
+		common.HexToAddress(t.To()),
+		&value,
+		t.Data(),
+		[]interface{}{}, // access list
+	}
+}
+
+// legacyFields returns transaction fields in order of RLP encoding
+func (s *Signer) legacyFields(t *Transaction) []interface{} {
+	gasPrice := t.GasPrice()
+	value := t.Value()
+
+	return []interface{}{
+		t.Nonce(),
+		&gasPrice,
+		t.Gas(),
+		common.HexToAddress(t.To()),
+		&value,
+		t.Data(),
+	}
+}
+
+func (s *Signer) loadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("can't open key file: %v", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if err := s.addKey(scanner.Text()); err != nil {
+			return fmt.Errorf("wrong key in file `%s`: %v", path, err)
+		}
+	}
+
+	return scanner.Err()
+}
+
+func (s *Signer) addKey(hexKey string) error {
+	hexKey = helper.TrimHexPrefix(strings.TrimSpace(hexKey))
+	if hexKey == "" {
+		return nil
+	}
+
+	key, err := crypto.HexToECDSA(hexKey)
+	if err != nil {
+		return err
+	}
+
+	addr := crypto.PubkeyToAddress(key.PublicKey)
+	s.keys[normalizeAddress(addr.Hex())] = key
+
+	return nil
+}
+
+// normalizeAddress returns lowercase address without hex prefix
+func normalizeAddress(addr string) string {
+	return strings.ToLower(helper.TrimHexPrefix(addr))
+}
@@ -0,0 +1,229 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/kainobor/eth-client/app/config"
+)
+
+const (
+	// Key and transaction from example of EIP-155
+	eip155Key = "4646464646464646464646464646464646464646464646464646464646464646"
+	eip155To  = "3535353535353535353535353535353535353535"
+	eip155Raw = "0xf86c098504a817c800825208943535353535353535353535353535353535353535880de0b6b3a76400008025a028ef61340bd939bc2195fe537567866003e1a15d3c71ff63e1590620aa636276a067cbe9d8997f761aecb703304b3800ccf555c9f3dc64214b297fb1966a3b6d83"
+
+	otherKey = "0x4c0883a69102937d6231471b5dbb6204fe5129617082792ae468d01a3f362318"
+)
+
+// dynamicFeeEnvelope is signed EIP-1559 transaction after type byte
+type dynamicFeeEnvelope struct {
+	ChainID    *big.Int
+	Nonce      uint64
+	MaxTip     *big.Int
+	MaxFee     *big.Int
+	Gas        uint64
+	To         common.Address
+	Value      *big.Int
+	Data       []byte
+	AccessList []interface{}
+	V          uint
+	R          *big.Int
+	S          *big.Int
+}
+
+func TestSignLegacy(t *testing.T) {
+	tests := []struct {
+		name    string
+		chainID int64
+		raw     string // Expected payload, only sender is checked if empty
+	}{
+		{name: "EIP-155 example", chainID: 1, raw: eip155Raw},
+		{name: "chain with big ID", chainID: 11155111},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestSigner(t, tt.chainID, eip155Key)
+			tx := eip155Transaction(t)
+			if err := s.Sign(tx); err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.raw != "" && hexutil.Encode(tx.Raw()) != tt.raw {
+				t.Fatalf("expected payload %s, got %s", tt.raw, hexutil.Encode(tx.Raw()))
+			}
+
+			var fields []interface{}
+			if err := rlp.DecodeBytes(tx.Raw(), &fields); err != nil || len(fields) != 9 {
+				t.Fatalf("can't decode signed transaction: %v", err)
+			}
+			v := new(big.Int).SetBytes(fields[6].([]byte))
+			r, sv := fields[7].([]byte), fields[8].([]byte)
+
+			// v = recovery ID + chainID * 2 + 35
+			recovery := new(big.Int).Sub(v, big.NewInt(tt.chainID*2+35))
+			if recovery.Int64() != 0 && recovery.Int64() != 1 {
+				t.Fatalf("wrong v %s for chain %d", v, tt.chainID)
+			}
+
+			unsigned, err := rlp.EncodeToBytes(append(s.legacyFields(tx), big.NewInt(tt.chainID), uint(0), uint(0)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkSender(t, crypto.Keccak256(unsigned), r, sv, byte(recovery.Int64()), tx.From())
+		})
+	}
+}
+
+func TestSignDynamicFee(t *testing.T) {
+	s := newTestSigner(t, 1, eip155Key)
+	tx, err := NewTokenTransaction(addressOf(t, eip155Key), eip155To, "0x3e8", &Token{address: "dac17f958d2ee523a2206206994597c13d831ec7"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.SetNonce(9)
+	tx.ApplyFees(&Fees{Gas: 60000, MaxFeePerGas: *big.NewInt(30000000000), MaxPriorityFeePerGas: *big.NewInt(2000000000)})
+
+	if err := s.Sign(tx); err != nil {
+		t.Fatal(err)
+	}
+
+	raw := tx.Raw()
+	if raw[0] != dynamicFeeTxType {
+		t.Fatalf("expected envelope of type 0x02, got 0x%x", raw[0])
+	}
+	var env dynamicFeeEnvelope
+	if err := rlp.DecodeBytes(raw[1:], &env); err != nil {
+		t.Fatalf("can't decode signed transaction: %v", err)
+	}
+
+	switch {
+	case env.ChainID.Int64() != 1 || env.Nonce != 9 || env.Gas != 60000:
+		t.Errorf("wrong chain ID, nonce or gas: %d, %d, %d", env.ChainID, env.Nonce, env.Gas)
+	case env.MaxTip.Int64() != 2000000000 || env.MaxFee.Int64() != 30000000000:
+		t.Errorf("wrong fees: %s, %s", env.MaxTip, env.MaxFee)
+	case normalizeAddress(env.To.Hex()) != "dac17f958d2ee523a2206206994597c13d831ec7" || env.Value.BitLen() != 0:
+		t.Errorf("token transfer must be sent to contract without value")
+	case !bytes.Equal(env.Data, tx.Data()) || len(env.AccessList) != 0:
+		t.Errorf("wrong data or access list")
+	case env.V > 1:
+		t.Errorf("expected y-parity as v, got %d", env.V)
+	}
+
+	unsigned, err := rlp.EncodeToBytes(s.dynamicFeeFields(tx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSender(t, crypto.Keccak256([]byte{dynamicFeeTxType}, unsigned), env.R.Bytes(), env.S.Bytes(), byte(env.V), tx.From())
+}
+
+func TestSignWithoutKey(t *testing.T) {
+	s := newTestSigner(t, 1, eip155Key)
+	tx, err := NewTransaction(addressOf(t, otherKey), eip155To, "0x1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.CanSign(tx.From()) {
+		t.Error("signer can sign without key")
+	}
+	if err := s.Sign(tx); err == nil {
+		t.Error("expected error of missing key")
+	}
+}
+
+func TestNewSignerLoadsKeys(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Keys with and without prefix, spaces and empty lines are allowed
+	file := filepath.Join(dir, "keys")
+	if err := ioutil.WriteFile(file, []byte("\n  0x"+eip155Key+"  \n\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	const env = "ETH_CLIENT_TEST_KEYS"
+	os.Setenv(env, otherKey+", ")
+	defer os.Unsetenv(env)
+
+	s, err := NewSigner(&config.BlockchainConfig{ChainID: 1, KeyFiles: []string{file}, KeysEnv: env})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{eip155Key, otherKey} {
+		if addr := addressOf(t, key); !s.CanSign(addr) || !s.CanSign("0x"+addr) {
+			t.Errorf("key of `%s` is not loaded", addr)
+		}
+	}
+
+	// Wrong key is never skipped
+	os.Setenv(env, "0x1234")
+	if _, err := NewSigner(&config.BlockchainConfig{ChainID: 1, KeysEnv: env}); err == nil {
+		t.Error("expected error of wrong key in environment variable")
+	}
+	if _, err := NewSigner(&config.BlockchainConfig{ChainID: 1, KeyFiles: []string{filepath.Join(dir, "absent")}}); err == nil {
+		t.Error("expected error of absent key file")
+	}
+}
+
+func newTestSigner(t *testing.T, chainID int64, keys ...string) *Signer {
+	s := &Signer{chainID: big.NewInt(chainID), keys: make(map[string]*ecdsa.PrivateKey)}
+	for _, key := range keys {
+		if err := s.addKey(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return s
+}
+
+// eip155Transaction returns unsigned transaction from example of EIP-155
+func eip155Transaction(t *testing.T) *Transaction {
+	tx, err := NewTransaction(addressOf(t, eip155Key), eip155To, "0xde0b6b3a7640000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.SetNonce(9)
+	tx.SetGas(21000)
+	tx.SetGasPrice(*big.NewInt(20000000000))
+
+	return tx
+}
+
+func addressOf(t *testing.T, hexKey string) string {
+	key, err := crypto.HexToECDSA(hexKey[len(hexKey)-64:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return normalizeAddress(crypto.PubkeyToAddress(key.PublicKey).Hex())
+}
+
+// checkSender recovers address from signature of hash and compares it with sender
+func checkSender(t *testing.T, hash, r, s []byte, recovery byte, from string) {
+	t.Helper()
+	sig := make([]byte, 65)
+	copy(sig[32-len(r):32], r)
+	copy(sig[64-len(s):64], s)
+	sig[64] = recovery
+
+	pub, err := crypto.SigToPub(hash, sig)
+	if err != nil {
+		t.Fatalf("can't recover sender: %v", err)
+	}
+	if addr := normalizeAddress(crypto.PubkeyToAddress(*pub).Hex()); addr != normalizeAddress(from) {
+		t.Errorf("expected sender `%s`, recovered `%s`", from, addr)
+	}
+}
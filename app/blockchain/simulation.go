@@ -0,0 +1,89 @@
+package blockchain
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/kainobor/eth-client/app/helper"
+)
+
+type (
+	// Simulation is result of pre-flight check of transaction
+	Simulation struct {
+		Fees         *Fees
+		MaxCost      big.Int // Value with max fee for all gas
+		Balance      big.Int // ETH balance of sender
+		TokenBalance big.Int // Token balance of sender for token transfers
+		Output       []byte  // Result of execution with eth_call
+	}
+)
+
+// Simulate checks that transaction can be sent: sender's key is known, gas can be estimated,
+// execution doesn't fail and sender has enough funds for value, tokens and max fee
+func (cl *Client) Simulate(ctx context.Context, t *Transaction) (*Simulation, error) {
+	if !cl.signer.CanSign(t.From()) {
+		return nil, fmt.Errorf("no private key for sender `%s`", t.From())
+	}
+
+	fees, err := cl.fees.Estimate(ctx, t)
+	if err != nil {
+		return nil, fmt.Errorf("can't estimate fees: %v", err)
+	}
+
+	sim := &Simulation{Fees: fees}
+	if sim.Output, err = cl.Call(ctx, t); err != nil {
+		return nil, fmt.Errorf("execution failed: %v", err)
+	}
+
+	feePerGas := fees.GasPrice
+	if fees.MaxFeePerGas.BitLen() > 0 {
+		feePerGas = fees.MaxFeePerGas
+	}
+	value := t.Value()
+	sim.MaxCost.Mul(new(big.Int).SetUint64(fees.Gas), &feePerGas)
+	sim.MaxCost.Add(&sim.MaxCost, &value)
+
+	balance, err := cl.GetBalance(ctx, "0x"+helper.TrimHexPrefix(t.From()))
+	if err != nil {
+		return nil, err
+	}
+	sim.Balance = *balance
+
+	if sim.Balance.Cmp(&sim.MaxCost) < 0 {
+		return nil, fmt.Errorf("insufficient funds: balance %s, needed %s", helper.BigToHex(sim.Balance), helper.BigToHex(sim.MaxCost))
+	}
+
+	token, ok := cl.tokens.ByAddress(t.Token())
+	if !ok {
+		return sim, nil
+	}
+
+	balances, err := cl.GetTokenBalances(ctx, token, []string{t.From()})
+	if err != nil {
+		return nil, err
+	}
+	sim.TokenBalance = *balances[t.From()]
+
+	amount := t.Amount()
+	if sim.TokenBalance.Cmp(&amount) < 0 {
+		return nil, fmt.Errorf("insufficient %s: balance %s, needed %s", token.Symbol(), helper.BigToHex(sim.TokenBalance), helper.BigToHex(amount))
+	}
+
+	return sim, nil
+}
+
+// Call executes transaction with eth_call without sending it and returns result of execution
+func (cl *Client) Call(ctx context.Context, t *Transaction) ([]byte, error) {
+	var outputHex string
+	if err := cl.pool.call(ctx, &outputHex, callMethod, t, "pending"); err != nil {
+		return nil, err
+	}
+
+	output, ok := helper.HexToBytes(outputHex)
+	if !ok {
+		return nil, fmt.Errorf("can't parse `%s` as call result", outputHex)
+	}
+
+	return output, nil
+}
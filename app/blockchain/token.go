@@ -0,0 +1,230 @@
+package blockchain
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/kainobor/eth-client/app/config"
+	"github.com/kainobor/eth-client/app/helper"
+)
+
+type (
+	// Token represents ERC-20 token contract
+	Token struct {
+		symbol   string
+		address  string
+		decimals int
+	}
+
+	// TokenRegistry contains all tokens known by application
+	TokenRegistry struct {
+		bySymbol  map[string]*Token
+		byAddress map[string]*Token
+	}
+)
+
+const (
+	callMethod = "eth_call"
+
+	// abiWordLength is length of one argument in ABI encoding
+	abiWordLength = 32
+)
+
+var (
+	// transferSelector is first 4 bytes of keccak256("transfer(address,uint256)")
+	transferSelector = []byte{0xa9, 0x05, 0x9c, 0xbb}
+	// balanceOfSelector is first 4 bytes of keccak256("balanceOf(address)")
+	balanceOfSelector = []byte{0x70, 0xa0, 0x82, 0x31}
+)
+
+// NewTokenRegistry is constructor for registry of tokens from config
+func NewTokenRegistry(c []*config.TokenConfig) *TokenRegistry {
+	r := &TokenRegistry{bySymbol: make(map[string]*Token), byAddress: make(map[string]*Token)}
+	for _, tc := range c {
+		t := &Token{symbol: strings.ToUpper(tc.Symbol), address: normalizeAddress(tc.Address), decimals: tc.Decimals}
+		r.bySymbol[t.symbol] = t
+		r.byAddress[t.address] = t
+	}
+
+	return r
+}
+
+// BySymbol returns token with symbol
+func (r *TokenRegistry) BySymbol(symbol string) (*Token, bool) {
+	t, ok := r.bySymbol[strings.ToUpper(symbol)]
+
+	return t, ok
+}
+
+// ByAddress returns token with contract address
+func (r *TokenRegistry) ByAddress(addr string) (*Token, bool) {
+	t, ok := r.byAddress[normalizeAddress(addr)]
+
+	return t, ok
+}
+
+// All returns all tokens of registry
+func (r *TokenRegistry) All() []*Token {
+	tokens := make([]*Token, 0, len(r.bySymbol))
+	for _, t := range r.bySymbol {
+		tokens = append(tokens, t)
+	}
+
+	return tokens
+}
+
+// Symbol is getter
+func (t *Token) Symbol() string {
+	return t.symbol
+}
+
+// Address is getter for contract address
+func (t *Token) Address() string {
+	return t.address
+}
+
+// Decimals is getter
+func (t *Token) Decimals() int {
+	return t.decimals
+}
+
+// ParseUnits converts decimal amount of whole tokens, like `1.5`, to minimal units of token
+func (t *Token) ParseUnits(amount string) (*big.Int, error) {
+	parts := strings.SplitN(amount, ".", 2)
+	whole, fraction := parts[0], ""
+	if len(parts) == 2 {
+		fraction = parts[1]
+	}
+
+	if len(fraction) > t.decimals {
+		return nil, fmt.Errorf("token `%s` has only %d decimals", t.symbol, t.decimals)
+	}
+	digits := whole + fraction + strings.Repeat("0", t.decimals-len(fraction))
+	if whole == "" || strings.Trim(digits, "0123456789") != "" {
+		return nil, fmt.Errorf("can't parse `%s` as amount of token", amount)
+	}
+
+	units, ok := new(big.Int).SetString(digits, 10)
+	if !ok {
+		return nil, fmt.Errorf("can't parse `%s` as amount of token", amount)
+	}
+
+	return units, nil
+}
+
+// FormatUnits converts minimal units of token to decimal amount of whole tokens
+func (t *Token) FormatUnits(units big.Int) string {
+	digits := units.String()
+	if t.decimals <= 0 || units.Sign() < 0 {
+		return digits
+	}
+
+	if len(digits) <= t.decimals {
+		digits = strings.Repeat("0", t.decimals-len(digits)+1) + digits
+	}
+	whole, fraction := digits[:len(digits)-t.decimals], strings.TrimRight(digits[len(digits)-t.decimals:], "0")
+	if fraction == "" {
+		return whole
+	}
+
+	return whole + "." + fraction
+}
+
+// NewTokenTransaction is constructor for transaction that transfers ERC-20 tokens
+func NewTokenTransaction(from, to, amount string, token *Token) (*Transaction, error) {
+	bigAmount, ok := helper.HexToBig(amount)
+	if !ok {
+		return nil, fmt.Errorf("can't parsing `%s` to big.Int", amount)
+	}
+
+	return &Transaction{
+		from:      helper.TrimHexPrefix(from),
+		to:        token.address,
+		recipient: helper.TrimHexPrefix(to),
+		token:     token.address,
+		amount:    *bigAmount,
+		data:      EncodeTransfer(to, bigAmount),
+	}, nil
+}
+
+// EncodeTransfer returns calldata of transfer(address,uint256) call
+func EncodeTransfer(to string, amount *big.Int) []byte {
+	data := append([]byte{}, transferSelector...)
+	data = append(data, common.LeftPadBytes(common.HexToAddress(to).Bytes(), abiWordLength)...)
+
+	return append(data, common.LeftPadBytes(amount.Bytes(), abiWordLength)...)
+}
+
+// DecodeTransfer parses calldata of transfer(address,uint256) call
+func DecodeTransfer(data []byte) (string, *big.Int, bool) {
+	if len(data) != len(transferSelector)+2*abiWordLength || !bytes.Equal(data[:len(transferSelector)], transferSelector) {
+		return "", nil, false
+	}
+
+	args := data[len(transferSelector):]
+	to := common.BytesToAddress(args[:abiWordLength])
+	amount := new(big.Int).SetBytes(args[abiWordLength:])
+
+	return normalizeAddress(to.Hex()), amount, true
+}
+
+// encodeBalanceOf returns calldata of balanceOf(address) call
+func encodeBalanceOf(addr string) []byte {
+	data := append([]byte{}, balanceOfSelector...)
+
+	return append(data, common.LeftPadBytes(common.HexToAddress(addr).Bytes(), abiWordLength)...)
+}
+
+// GetTokenBalances returns token balances of addresses with batched balanceOf calls
+func (cl *Client) GetTokenBalances(ctx context.Context, token *Token, addrs []string) (map[string]*big.Int, error) {
+	batchSize := cl.config.BalanceBatchSize
+	if batchSize <= 0 {
+		batchSize = len(addrs)
+	}
+
+	balances := make(map[string]*big.Int, len(addrs))
+	var failed []string
+	for start := 0; start < len(addrs); start += batchSize {
+		end := start + batchSize
+		if end > len(addrs) {
+			end = len(addrs)
+		}
+
+		part := addrs[start:end]
+		results := make([]string, len(part))
+		batch := make([]rpc.BatchElem, len(part))
+		for i, addr := range part {
+			call := map[string]interface{}{
+				"to":   "0x" + token.address,
+				"data": hexutil.Encode(encodeBalanceOf(addr)),
+			}
+			batch[i] = rpc.BatchElem{Method: callMethod, Args: []interface{}{call, "latest"}, Result: &results[i]}
+		}
+
+		if err := cl.pool.batchCall(ctx, batch); err != nil {
+			failed = append(failed, part...)
+			continue
+		}
+
+		for i, elem := range batch {
+			balance, ok := helper.HexToBig(results[i])
+			if elem.Error != nil || !ok {
+				failed = append(failed, part[i])
+				continue
+			}
+			balances[part[i]] = balance
+		}
+	}
+
+	if len(failed) > 0 {
+		return balances, fmt.Errorf("can't get %s balances of %d addresses: %s", token.symbol, len(failed), strings.Join(failed, ", "))
+	}
+
+	return balances, nil
+}
@@ -7,6 +7,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/kainobor/eth-client/app/helper"
 )
 
@@ -18,6 +19,18 @@ type (
 		from          string
 		to            string
 		value         big.Int
+		recipient     string  // Receiver of tokens, "to" is token contract then
+		token         string  // Address of token contract for ERC-20 transfers
+		amount        big.Int // Amount of tokens
+		nonce         uint64
+		gas           uint64
+		gasPrice      big.Int
+		maxFee        big.Int
+		maxTip        big.Int
+		data          []byte
+		raw           []byte
+		replaces      string // Hash of transaction with the same nonce, that is replaced by this one
+		origin        string // Hash of first transaction of replacement chain
 		confirmations int64
 		block         Block
 		status        string
@@ -40,19 +53,29 @@ type (
 		From          string
 		To            string
 		Confirmations int64
-		Amount        string
+		Amount        *big.Int // Amount in wei or in minimal units of token
+		Token         string
 		Status        string
 		CreatedAt     time.Time
 	}
-)
 
-const (
-	// PendingStatus is status for pending transaction
-	PendingStatus = "pending"
-	// SuccessStatus is status for confirmed transaction
-	SuccessStatus = "success"
-	// FailStatus is status for transaction that is not in network already
-	FailStatus = "fail"
+	// DBWithdraw represents sent transaction data, that saved in DB
+	DBWithdraw struct {
+		Hash     string
+		From     string
+		To       string
+		Amount   *big.Int
+		Token    string
+		Nonce    int64
+		Gas      int64
+		GasPrice string
+		MaxFee   string
+		MaxTip   string
+		Data     string
+		Raw      string
+		Origin   string
+		Status   string
+	}
 )
 
 // NewTransaction is constructor for transactions
@@ -68,14 +91,44 @@ func NewTransaction(from, to, value string) (*Transaction, error) {
 	return &Transaction{from: from, to: to, value: *bigValue}, nil
 }
 
+// NewReplacement is constructor for transaction, that makes the same transfer as previous one
+// with its nonce, so only one of them is mined
+func NewReplacement(prev *Transaction) *Transaction {
+	prev.RLock()
+	defer prev.RUnlock()
+
+	return &Transaction{
+		from:      prev.from,
+		to:        prev.to,
+		value:     prev.value,
+		recipient: prev.recipient,
+		token:     prev.token,
+		amount:    prev.amount,
+		nonce:     prev.nonce,
+		data:      prev.data,
+	}
+}
+
+// NewCancellation is constructor for zero-value transfer to sender itself with nonce of previous
+// transaction. Being mined, it cancels previous one
+func NewCancellation(prev *Transaction) *Transaction {
+	prev.RLock()
+	defer prev.RUnlock()
+
+	return &Transaction{from: prev.from, to: prev.from, nonce: prev.nonce}
+}
+
 // MarshalJSON implements the json.Unmarshaler interface
 func (t *Transaction) MarshalJSON() ([]byte, error) {
 	t.RLock()
 	params := map[string]interface{}{
-		"from":  t.from,
-		"to":    t.to,
+		"from":  "0x" + helper.TrimHexPrefix(t.from),
+		"to":    "0x" + helper.TrimHexPrefix(t.to),
 		"value": helper.BigToHex(t.value),
 	}
+	if len(t.data) > 0 {
+		params["data"] = hexutil.Encode(t.data)
+	}
 	t.RUnlock()
 
 	return json.Marshal(params)
@@ -90,6 +143,7 @@ func (t *Transaction) UnmarshalJSON(data []byte) error {
 		To          string `json:"to"`
 		Hash        string `json:"hash"`
 		Value       string `json:"value"`
+		Input       string `json:"input"`
 	}{}
 
 	if err := json.Unmarshal(data, &params); err != nil {
@@ -109,17 +163,29 @@ func (t *Transaction) UnmarshalJSON(data []byte) error {
 	}
 	t.value = *val
 
+	// Pending transaction has no block yet
 	block := Block{}
 	block.hash = params.BlockHash
-	if blockNumber, ok = helper.HexToBig(params.BlockNumber); !ok {
-		t.Unlock()
-		return fmt.Errorf("wrong block number: %s", params.BlockNumber)
+	if params.BlockNumber != "" {
+		if blockNumber, ok = helper.HexToBig(params.BlockNumber); !ok {
+			t.Unlock()
+			return fmt.Errorf("wrong block number: %s", params.BlockNumber)
+		}
+		block.number = *blockNumber
+	}
+
+	if params.Input != "" {
+		input, err := hexutil.Decode(params.Input)
+		if err != nil {
+			t.Unlock()
+			return fmt.Errorf("wrong transaction input: %v", err)
+		}
+		t.data = input
 	}
-	block.number = *blockNumber
 
 	t.block = block
-	t.to = params.To
-	t.from = params.From
+	t.to = helper.TrimHexPrefix(params.To)
+	t.from = helper.TrimHexPrefix(params.From)
 
 	t.Unlock()
 	return nil
@@ -130,14 +196,13 @@ func (t *Transaction) FillFromDB(dbt *DBTransaction) error {
 	t.Lock()
 	defer t.Unlock()
 
-	val, ok := helper.HexToBig(dbt.Amount)
-	if !ok {
-		return fmt.Errorf("can't parse amount `%s` from DB", dbt.Amount)
+	if dbt.Amount == nil {
+		return fmt.Errorf("amount of transaction `%s` is not set in DB", dbt.Hash)
 	}
-	t.value = *val
+	t.value = *dbt.Amount
 
 	block := new(Block)
-	block.hash = dbt.Hash
+	block.hash = dbt.BlockHash
 	block.number = *big.NewInt(dbt.BlockNumber)
 	t.block = *block
 
@@ -145,6 +210,13 @@ func (t *Transaction) FillFromDB(dbt *DBTransaction) error {
 	t.hash = dbt.Hash
 	t.from = dbt.From
 	t.to = dbt.To
+	if dbt.Token != "" {
+		t.token = dbt.Token
+		t.recipient = dbt.To
+		t.to = dbt.Token
+		t.amount = t.value
+		t.value = *big.NewInt(0)
+	}
 	t.confirmations = dbt.Confirmations
 	t.status = dbt.Status
 	t.createdAt = dbt.CreatedAt
@@ -152,6 +224,58 @@ func (t *Transaction) FillFromDB(dbt *DBTransaction) error {
 	return nil
 }
 
+// FillFromWithdraw gets values of sent transaction from DB and updates transaction with them
+func (t *Transaction) FillFromWithdraw(dbw *DBWithdraw) error {
+	t.Lock()
+	defer t.Unlock()
+
+	if dbw.Amount == nil {
+		return fmt.Errorf("amount of transaction `%s` is not set in DB", dbw.Hash)
+	}
+	amount := dbw.Amount
+
+	gasPrice, ok := helper.HexToBig(dbw.GasPrice)
+	if !ok {
+		return fmt.Errorf("can't parse gas price `%s` from DB", dbw.GasPrice)
+	}
+	maxFee, ok := helper.HexToBig(dbw.MaxFee)
+	if !ok {
+		return fmt.Errorf("can't parse max fee `%s` from DB", dbw.MaxFee)
+	}
+	maxTip, ok := helper.HexToBig(dbw.MaxTip)
+	if !ok {
+		return fmt.Errorf("can't parse max priority fee `%s` from DB", dbw.MaxTip)
+	}
+
+	if t.data, ok = helper.HexToBytes(dbw.Data); !ok {
+		return fmt.Errorf("can't parse data `%s` from DB", dbw.Data)
+	}
+	if t.raw, ok = helper.HexToBytes(dbw.Raw); !ok {
+		return fmt.Errorf("can't parse raw transaction `%s` from DB", dbw.Raw)
+	}
+
+	t.hash = dbw.Hash
+	t.from = dbw.From
+	t.to = dbw.To
+	if dbw.Token != "" {
+		t.token = dbw.Token
+		t.recipient = dbw.To
+		t.to = dbw.Token
+		t.amount = *amount
+	} else {
+		t.value = *amount
+	}
+	t.nonce = uint64(dbw.Nonce)
+	t.gas = uint64(dbw.Gas)
+	t.gasPrice = *gasPrice
+	t.maxFee = *maxFee
+	t.maxTip = *maxTip
+	t.origin = dbw.Origin
+	t.status = dbw.Status
+
+	return nil
+}
+
 // FixateCreatedAt saved current time as "createdAt"
 func (t *Transaction) FixateCreatedAt() {
 	t.Lock()
@@ -177,6 +301,39 @@ func (t *Transaction) BlockNumber() big.Int {
 	return t.block.number
 }
 
+// IsMined checks that transaction is included in block
+func (t *Transaction) IsMined() bool {
+	t.RLock()
+	defer t.RUnlock()
+
+	return t.block.hash != ""
+}
+
+// ResetBlock is synchronous setter, that removes transaction from block
+// that is not in main chain anymore
+func (t *Transaction) ResetBlock() {
+	t.Lock()
+	t.block = Block{}
+	t.confirmations = 0
+	t.Unlock()
+}
+
+// Inclusion is synchronous getter of block and confirmations, that can be restored with SetInclusion
+func (t *Transaction) Inclusion() (Block, int64) {
+	t.RLock()
+	defer t.RUnlock()
+
+	return t.block, t.confirmations
+}
+
+// SetInclusion is synchronous setter of block and confirmations, that were got by Inclusion
+func (t *Transaction) SetInclusion(block Block, confirmations int64) {
+	t.Lock()
+	t.block = block
+	t.confirmations = confirmations
+	t.Unlock()
+}
+
 // Confirmations is synchronous getter
 func (t *Transaction) Confirmations() int64 {
 	t.RLock()
@@ -246,6 +403,179 @@ func (t *Transaction) Value() big.Int {
 	return t.value
 }
 
+// Nonce is synchronous getter
+func (t *Transaction) Nonce() uint64 {
+	t.RLock()
+	defer t.RUnlock()
+
+	return t.nonce
+}
+
+// SetNonce is synchronous setter
+func (t *Transaction) SetNonce(nonce uint64) {
+	t.Lock()
+	t.nonce = nonce
+	t.Unlock()
+}
+
+// Gas is synchronous getter
+func (t *Transaction) Gas() uint64 {
+	t.RLock()
+	defer t.RUnlock()
+
+	return t.gas
+}
+
+// SetGas is synchronous setter
+func (t *Transaction) SetGas(gas uint64) {
+	t.Lock()
+	t.gas = gas
+	t.Unlock()
+}
+
+// GasPrice is synchronous getter
+func (t *Transaction) GasPrice() big.Int {
+	t.RLock()
+	defer t.RUnlock()
+
+	return t.gasPrice
+}
+
+// SetGasPrice is synchronous setter
+func (t *Transaction) SetGasPrice(gasPrice big.Int) {
+	t.Lock()
+	t.gasPrice = gasPrice
+	t.Unlock()
+}
+
+// MaxFeePerGas is synchronous getter
+func (t *Transaction) MaxFeePerGas() big.Int {
+	t.RLock()
+	defer t.RUnlock()
+
+	return t.maxFee
+}
+
+// MaxPriorityFeePerGas is synchronous getter
+func (t *Transaction) MaxPriorityFeePerGas() big.Int {
+	t.RLock()
+	defer t.RUnlock()
+
+	return t.maxTip
+}
+
+// IsDynamicFee checks that transaction uses EIP-1559 fees
+func (t *Transaction) IsDynamicFee() bool {
+	t.RLock()
+	defer t.RUnlock()
+
+	return t.maxFee.BitLen() > 0
+}
+
+// ApplyFees is synchronous setter for all gas values
+func (t *Transaction) ApplyFees(f *Fees) {
+	t.Lock()
+	t.gas = f.Gas
+	t.gasPrice = f.GasPrice
+	t.maxFee = f.MaxFeePerGas
+	t.maxTip = f.MaxPriorityFeePerGas
+	t.Unlock()
+}
+
+// Data is synchronous getter
+func (t *Transaction) Data() []byte {
+	t.RLock()
+	defer t.RUnlock()
+
+	return t.data
+}
+
+// Raw is synchronous getter for signed RLP-encoded transaction
+func (t *Transaction) Raw() []byte {
+	t.RLock()
+	defer t.RUnlock()
+
+	return t.raw
+}
+
+// SetRaw is synchronous setter
+func (t *Transaction) SetRaw(raw []byte) {
+	t.Lock()
+	t.raw = raw
+	t.Unlock()
+}
+
+// Token is synchronous getter, empty for ETH transfers
+func (t *Transaction) Token() string {
+	t.RLock()
+	defer t.RUnlock()
+
+	return t.token
+}
+
+// Recipient is synchronous getter for receiver of transferred ETH or tokens
+func (t *Transaction) Recipient() string {
+	t.RLock()
+	defer t.RUnlock()
+
+	if t.token != "" {
+		return t.recipient
+	}
+
+	return t.to
+}
+
+// Amount is synchronous getter for transferred ETH or tokens
+func (t *Transaction) Amount() big.Int {
+	t.RLock()
+	defer t.RUnlock()
+
+	if t.token != "" {
+		return t.amount
+	}
+
+	return t.value
+}
+
+// SetTokenTransfer is synchronous setter, that marks transaction as transfer of tokens
+func (t *Transaction) SetTokenTransfer(token, recipient string, amount big.Int) {
+	t.Lock()
+	t.token = token
+	t.recipient = recipient
+	t.amount = amount
+	t.Unlock()
+}
+
+// Replaces is synchronous getter, empty if transaction doesn't replace other one
+func (t *Transaction) Replaces() string {
+	t.RLock()
+	defer t.RUnlock()
+
+	return t.replaces
+}
+
+// Origin is synchronous getter for hash of first transaction of replacement chain
+func (t *Transaction) Origin() string {
+	t.RLock()
+	defer t.RUnlock()
+
+	if t.origin == "" {
+		return t.hash
+	}
+
+	return t.origin
+}
+
+// SetReplaced is synchronous setter, that marks transaction as replacement of previous one
+func (t *Transaction) SetReplaced(prev *Transaction) {
+	replaces, origin := prev.Hash(), prev.Origin()
+
+	t.Lock()
+	t.replaces = replaces
+	t.origin = origin
+	t.Unlock()
+}
+
 // Hash is synchronous getter
 func (t *Transaction) Hash() string {
 	t.RLock()
@@ -12,6 +12,7 @@ import (
 type (
 	// Config is wrapper for configurations af all modules
 	Config struct {
+		Network      string // Name of used network from [networks] section, common settings are used if empty
 		Server       *ServerConfig
 		Blockchain   *BlockchainConfig
 		Storage      *StorageConfig
@@ -20,6 +21,14 @@ type (
 		Logger       *LoggerConfig
 	}
 
+	// NetworkConfig contains settings of named network, that override common ones.
+	// Lists are not merged with common ones but replace them
+	NetworkConfig struct {
+		Blockchain   *BlockchainConfig
+		Storage      *StorageConfig // Usually only schema, so networks don't share data
+		Confirmation *ConfirmationConfig
+	}
+
 	// ServerConfig is config for TCP-server
 	ServerConfig struct {
 		Port int
@@ -27,17 +36,86 @@ type (
 
 	// BlockchainConfig is config for blockchain network client
 	BlockchainConfig struct {
-		IP   string
-		Port int
+		IP             string
+		Port           int
+		WSPort         int               // Port of websocket endpoint, zero if node speaks only HTTP
+		Endpoints      []*EndpointConfig // Pool of nodes, single node from IP and ports is used if empty
+		HealthInterval time.Duration     // How often nodes of pool are probed
+		MaxBlockLag    int64             // Node that is behind the others more than that is not used
+		MaxLatency     time.Duration     // Node that answers slower than that is not used, zero for unlimited
+		MaxErrorRate   float64           // Node with bigger share of failed calls is not used, zero for unlimited
+		ChainID        int64             // Chain ID used in transaction signatures (EIP-155) and expected from nodes
+		NetworkID      int64             // Network ID expected from nodes, equals to chain ID if empty
+		KeyFiles       []string          // Files with hex-encoded private keys, one per line
+		KeysEnv        string            // Environment variable with comma-separated hex-encoded private keys
+		Fee            *FeeConfig
+		Tokens         []*TokenConfig // Registry of ERC-20 tokens
+		Timeouts       *TimeoutConfig // Default timeouts of RPC calls, calls are unlimited if empty
+		Retry          *RetryConfig   // Default retry policy of RPC calls
+		MethodRetries  []*RetryConfig // Retry policies of certain methods
+		Breaker        *BreakerConfig // Circuit breaker of endpoints
+
+		BalanceBatchSize   int // Amount of balances in one batch request
+		BalanceConcurrency int // Amount of batch requests at the same time
+	}
+
+	// EndpointConfig is config for one node of blockchain client pool
+	EndpointConfig struct {
+		IP     string
+		Port   int
+		WSPort int
+		Weight int // Share of calls relative to other nodes
+	}
+
+	// TokenConfig is config for ERC-20 token
+	TokenConfig struct {
+		Symbol   string
+		Address  string
+		Decimals int
+	}
+
+	// TimeoutConfig is config for default timeouts of RPC calls by kind of method.
+	// Zero timeout of kind means that default one is used
+	TimeoutConfig struct {
+		Default  time.Duration // Calls of other methods and health probes
+		Send     time.Duration // Sending of raw transactions
+		Estimate time.Duration // Estimation of gas and fees
+		Balance  time.Duration // Balance calls, per batch
+		Block    time.Duration // Blocks, transactions and receipts
+	}
+
+	// RetryConfig is config for retry policy of RPC calls with transient errors
+	RetryConfig struct {
+		Method     string        // JSON-RPC method of policy, empty for default one
+		Attempts   int           // Max amount of attempts including the first one
+		MinBackoff time.Duration // Pause before first retry, doubled before each next one
+		MaxBackoff time.Duration // Upper limit of pause
+	}
+
+	// BreakerConfig is config for circuit breakers, that stop calls to failing endpoints
+	BreakerConfig struct {
+		Failures int           // Failures in a row that open breaker, zero disables breakers
+		Cooldown time.Duration // How long open breaker rejects calls before trial ones
+	}
+
+	// FeeConfig is config for estimation of gas and fees
+	FeeConfig struct {
+		Strategy      string  // slow, normal or fast
+		HistoryBlocks int     // Amount of recent blocks for fee history
+		MaxFeeCapGwei int64   // Upper limit for fee per gas, zero for unlimited
+		GasMultiplier float64 // Reserve over estimated gas
 	}
 
 	// StorageConfig is config for DB-connection
 	StorageConfig struct {
+		Driver   string // postgres (default) or sqlite3
+		File     string // Database file of SQLite, schema name with .db extension if not set
 		IP       string
 		Port     int
 		User     string
 		Password string
 		DBName   string
+		Schema   string // Schema with application tables
 		PageSize int
 	}
 
@@ -46,6 +124,24 @@ type (
 		TransactionInterval time.Duration
 		CurBlockInterval    time.Duration
 		BalanceInterval     time.Duration
+		NonceInterval       time.Duration
+		ReconnectInterval   time.Duration // Pause before resubscribing to new heads
+		ScanInterval        time.Duration // How often blocks are scanned for deposits if no new blocks are pushed
+		ScanBatchSize       int64         // Max amount of blocks scanned at once
+		HeaderHistory       int64         // Amount of last block headers kept for reorganization detection
+		StuckInterval       time.Duration // How often sent transactions are checked for being stuck or dropped
+		StuckBlocks         int64         // Transaction is stuck if it is not mined after this amount of blocks, zero to ignore
+		StuckTimeout        time.Duration // Transaction is stuck if it is not mined after this time, zero to ignore
+		StuckPolicy         string        // alert or bump
+		MaxFeeBumps         int           // Max amount of replacements of transaction with bumped fee
+		OutboxWorkers       int           // Amount of workers, that send accepted requests from outbox
+		OutboxQueue         int           // Max amount of claimed requests, that are waiting for free worker
+		OutboxLimit         int           // Max amount of unsent requests in outbox, new ones are rejected then, zero for unlimited
+		OutboxInterval      time.Duration // How often workers check outbox for new requests
+		OutboxLease         time.Duration // Request is claimed again if worker didn't finish it during this time
+		OutboxAttempts      int           // Max attempts to send request before it is failed, zero for unlimited
+		ConfirmWorkers      int           // Amount of workers, that check blocks and confirmations of transactions
+		ConfirmQueue        int           // Max amount of transactions, that are waiting for check
 	}
 
 	// ConfirmationConfig that contains data about acceptance of confirmations
@@ -61,6 +157,9 @@ type (
 	}
 )
 
+// networksKey is section of config with named networks
+const networksKey = "networks"
+
 // Init configuration and read from file
 func Init(a *args.Args) (*Config, error) {
 	c := new(Config)
@@ -75,5 +174,47 @@ func Init(a *args.Args) (*Config, error) {
 		return nil, fmt.Errorf("error while unmarshaling config: %v", err)
 	}
 
+	if a.Network != "" {
+		c.Network = a.Network
+	}
+	if err := c.applyNetwork(vpr); err != nil {
+		return nil, err
+	}
+
 	return c, nil
 }
+
+// applyNetwork overrides common settings with settings of chosen network
+func (c *Config) applyNetwork(vpr *viper.Viper) error {
+	if c.Network == "" {
+		return nil
+	}
+
+	key := networksKey + "." + c.Network
+	nv := vpr.Sub(key)
+	if nv == nil {
+		return fmt.Errorf("unknown network `%s`", c.Network)
+	}
+
+	// Lists of network replace common ones instead of merging element by element
+	if nv.IsSet("blockchain.endpoints") {
+		c.Blockchain.Endpoints = nil
+	}
+	if nv.IsSet("blockchain.tokens") {
+		c.Blockchain.Tokens = nil
+	}
+	if nv.IsSet("blockchain.keyFiles") {
+		c.Blockchain.KeyFiles = nil
+	}
+	if nv.IsSet("blockchain.methodRetries") {
+		c.Blockchain.MethodRetries = nil
+	}
+
+	nc := &NetworkConfig{Blockchain: c.Blockchain, Storage: c.Storage, Confirmation: c.Confirmation}
+	if err := nv.Unmarshal(nc); err != nil {
+		return fmt.Errorf("error while unmarshaling config of network `%s`: %v", c.Network, err)
+	}
+	c.Blockchain, c.Storage, c.Confirmation = nc.Blockchain, nc.Storage, nc.Confirmation
+
+	return nil
+}
@@ -1,9 +1,11 @@
 package controller
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/kainobor/eth-client/app/blockchain"
@@ -18,7 +20,7 @@ type (
 	// Controller for TCP requests
 	Controller struct {
 		bc  *blockchain.Client
-		st  *storage.Storage
+		st  storage.Storage
 		h   *handler.Handler
 		cc  *config.ConfirmationConfig
 		log *logger.Logger
@@ -34,11 +36,49 @@ type (
 		Message string `json:"message"`
 	}
 
+	// SendResponse returns when send request is accepted
+	SendResponse struct {
+		Message   string `json:"message"`
+		RequestID string `json:"requestId"`
+		Status    string `json:"status"`
+		Hash      string `json:"hash,omitempty"`
+	}
+
+	// ReplaceResponse returns when transaction was replaced
+	ReplaceResponse struct {
+		Message string `json:"message"`
+		Hash    string `json:"hash"`
+	}
+
+	// SimulationResponse returns for dry run of sending
+	SimulationResponse struct {
+		Message              string `json:"message"`
+		Gas                  uint64 `json:"gas"`
+		GasPrice             string `json:"gasPrice,omitempty"`
+		MaxFeePerGas         string `json:"maxFeePerGas,omitempty"`
+		MaxPriorityFeePerGas string `json:"maxPriorityFeePerGas,omitempty"`
+		MaxCost              string `json:"maxCost"`
+		Balance              string `json:"balance"`
+		TokenBalance         string `json:"tokenBalance,omitempty"`
+		TokenBalanceUnits    string `json:"tokenBalanceUnits,omitempty"` // Token balance in whole tokens
+		Output               string `json:"output"`
+	}
+
+	// HistoryRecord is representation of transition of transaction status for History method's JSON
+	HistoryRecord struct {
+		Date       string `json:"date"`
+		RequestID  string `json:"requestId,omitempty"`
+		Hash       string `json:"hash,omitempty"`
+		FromStatus string `json:"fromStatus,omitempty"`
+		ToStatus   string `json:"toStatus"`
+	}
+
 	// LastTransaction is special representation of transaction for GetLast method's JSON
 	LastTransaction struct {
 		Date          string `json:"date"`
 		Address       string `json:"address"`
 		Amount        string `json:"amount"`
+		Token         string `json:"token,omitempty"`
 		Confirmations int64  `json:"confirmations"`
 	}
 )
@@ -47,12 +87,36 @@ const (
 	fromSendArg   = "from"
 	toSendArg     = "to"
 	amountSendArg = "amount"
+	tokenSendArg  = "token"
+	addressArg    = "address"
+	hashArg       = "hash"
+	dryRunArg     = "dryRun"
+	idArg         = "id"
+
+	// tokenAmountSendArg is amount in whole tokens, that is used instead of amount in minimal units
+	tokenAmountSendArg = "tokenAmount"
+
+	idempotencyKeyArg    = "idempotencyKey"
+	idempotencyKeyHeader = "Idempotency-Key"
+	// clientIDHeader is not authenticated here, it is trusted to be set by proxy in front of API,
+	// that authenticates clients and overwrites header of incoming requests
+	clientIDHeader = "X-Client-ID"
+
+	// retryAfterSeconds is pause, that client should make before retrying postponed request
+	retryAfterSeconds = "5"
+
+	// maxIdempotencyKeyLength and maxClientIDLength are max lengths, that can be saved
+	maxIdempotencyKeyLength = 255
+	maxClientIDLength       = 64
+
+	// hashLength is length of transaction hash without prefix
+	hashLength = 64
 )
 
 // New controller
 func New(
 	bc *blockchain.Client,
-	st *storage.Storage,
+	st storage.Storage,
 	h *handler.Handler,
 	cc *config.ConfirmationConfig,
 	log *logger.Logger,
@@ -84,9 +148,267 @@ func (ctrl *Controller) SendEth(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	go ctrl.h.ProcessTransaction(t)
+	ctrl.send(w, r, t)
+}
+
+// SendToken returns response for SendToken method
+func (ctrl *Controller) SendToken(w http.ResponseWriter, r *http.Request) {
+	var err error
+	params := r.URL.Query()
+
+	from := params.Get(fromSendArg)
+	to := params.Get(toSendArg)
+	amount := params.Get(amountSendArg)
+	symbol := params.Get(tokenSendArg)
+
+	token, ok := ctrl.bc.Tokens().BySymbol(symbol)
+	if !ok {
+		errMsg := "invalid request: unknown token"
+		ctrl.sendError(w, errMsg, "request", r.Body, "token", symbol)
+		return
+	}
+
+	// Amount in whole tokens is converted to minimal units by decimals of token
+	if tokenAmount := params.Get(tokenAmountSendArg); amount == "" && tokenAmount != "" {
+		units, err := token.ParseUnits(tokenAmount)
+		if err != nil {
+			errMsg := "invalid request: " + err.Error()
+			ctrl.sendError(w, errMsg, "request", r.Body, "error", err)
+			return
+		}
+		amount = helper.BigToHex(*units)
+	}
+
+	if err = ctrl.validateSendRequest(from, to, amount); err != nil {
+		errMsg := "invalid request: " + err.Error()
+		ctrl.sendError(w, errMsg, "request", r.Body, "error", err)
+		return
+	}
+
+	var t *blockchain.Transaction
+
+	t, err = blockchain.NewTokenTransaction(from, to, amount, token)
+	if err != nil {
+		errMsg := "error while creating transaction"
+		ctrl.sendError(w, errMsg, "request", r.Body, "error", err)
+		return
+	}
+
+	ctrl.send(w, r, t)
+}
+
+// send checks transaction against the chain and saves it to outbox for sending if check passed.
+// With dry run only result of the check is returned
+func (ctrl *Controller) send(w http.ResponseWriter, r *http.Request, t *blockchain.Transaction) {
+	clientID := r.Header.Get(clientIDHeader)
+	key := r.Header.Get(idempotencyKeyHeader)
+	if key == "" {
+		key = r.URL.Query().Get(idempotencyKeyArg)
+	}
+	if len(key) > maxIdempotencyKeyLength || len(clientID) > maxClientIDLength {
+		errMsg := "invalid request: idempotency key or client ID is too long"
+		ctrl.sendError(w, errMsg, "client", clientID, "key", key)
+		return
+	}
+	// Keys without client would be shared by all clients, so one of them could get request of another
+	if key != "" && clientID == "" {
+		errMsg := "invalid request: " + clientIDHeader + " header is required with idempotency key"
+		ctrl.sendError(w, errMsg, "key", key)
+		return
+	}
+
+	// Repeated request gets the original one without checks, that could fail after sending
+	if key != "" {
+		req, ok, err := ctrl.h.FindSendRequest(t, clientID, key)
+		if err == handler.ErrIdempotencyConflict {
+			errMsg := "invalid request: " + err.Error()
+			ctrl.sendError(w, errMsg, "client", clientID, "key", key)
+			return
+		} else if err != nil {
+			errMsg := "error while checking idempotency key"
+			ctrl.sendError(w, errMsg, "client", clientID, "key", key, "error", err)
+			return
+		} else if ok {
+			ctrl.sendJSON(w, newSendResponse("request is already accepted", req))
+			return
+		}
+	}
+
+	// Overloaded node is not asked for checks of requests, that can't be accepted anyway
+	if err := ctrl.h.CheckCapacity(); err == handler.ErrQueueFull {
+		ctrl.sendUnavailable(w, "too many transactions in queue, try later", "from", t.From(), "to", t.To())
+		return
+	} else if err != nil {
+		errMsg := "error while checking queue"
+		ctrl.sendError(w, errMsg, "error", err)
+		return
+	}
+
+	sim, err := ctrl.bc.Simulate(r.Context(), t)
+	if err != nil {
+		errMsg := "transaction rejected: " + err.Error()
+		ctrl.sendError(w, errMsg, "from", t.From(), "to", t.To(), "error", err)
+		return
+	}
+
+	if r.URL.Query().Get(dryRunArg) == "true" {
+		ctrl.sendJSON(w, ctrl.simulationResponse(t, sim))
+		return
+	}
 
-	ctrl.sendResponse(w, "transaction sent for processing", true)
+	req, err := ctrl.h.Enqueue(t, clientID, key)
+	if err == handler.ErrIdempotencyConflict {
+		errMsg := "invalid request: " + err.Error()
+		ctrl.sendError(w, errMsg, "client", clientID, "key", key)
+		return
+	} else if err != nil {
+		errMsg := "error while accepting transaction"
+		ctrl.sendError(w, errMsg, "from", t.From(), "to", t.To(), "error", err)
+		return
+	}
+
+	ctrl.sendJSON(w, newSendResponse("transaction accepted for sending", req))
+}
+
+func newSendResponse(msg string, req *storage.SendRequest) *SendResponse {
+	return &SendResponse{
+		Message:   msg,
+		RequestID: req.RequestID,
+		Status:    req.Status,
+		Hash:      req.Transaction.Hash(),
+	}
+}
+
+func (ctrl *Controller) sendJSON(w http.ResponseWriter, resp interface{}) {
+	respJSON, err := json.Marshal(resp)
+	if err != nil {
+		errMsg := "error while marshaling response"
+		ctrl.sendError(w, errMsg, "resp", resp, "error", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(200)
+	w.Write(respJSON)
+}
+
+func (ctrl *Controller) simulationResponse(t *blockchain.Transaction, sim *blockchain.Simulation) *SimulationResponse {
+	resp := &SimulationResponse{
+		Message: "transaction can be sent",
+		Gas:     sim.Fees.Gas,
+		MaxCost: helper.BigToHex(sim.MaxCost),
+		Balance: helper.BigToHex(sim.Balance),
+		Output:  helper.BytesToHex(sim.Output),
+	}
+	if sim.Fees.MaxFeePerGas.BitLen() > 0 {
+		resp.MaxFeePerGas = helper.BigToHex(sim.Fees.MaxFeePerGas)
+		resp.MaxPriorityFeePerGas = helper.BigToHex(sim.Fees.MaxPriorityFeePerGas)
+	} else {
+		resp.GasPrice = helper.BigToHex(sim.Fees.GasPrice)
+	}
+	if t.Token() != "" {
+		resp.TokenBalance = helper.BigToHex(sim.TokenBalance)
+		if token, ok := ctrl.bc.Tokens().ByAddress(t.Token()); ok {
+			resp.TokenBalanceUnits = token.FormatUnits(sim.TokenBalance)
+		}
+	}
+
+	return resp
+}
+
+// Watch returns response for Watch method, that adds address to watch-list of deposits
+func (ctrl *Controller) Watch(w http.ResponseWriter, r *http.Request) {
+	addr := r.URL.Query().Get(addressArg)
+	if !helper.IsHexAddress(addr) {
+		errMsg := "invalid request: wrong address in request"
+		ctrl.sendError(w, errMsg, "address", addr)
+		return
+	}
+
+	if err := ctrl.st.AddWatchedAddress(helper.TrimHexPrefix(addr)); err != nil {
+		errMsg := "error while adding address to watch-list"
+		ctrl.sendError(w, errMsg, "address", addr, "error", err)
+		return
+	}
+
+	ctrl.sendResponse(w, "address is watched", true)
+}
+
+// SpeedUp returns response for SpeedUp method, that resends pending transaction with bumped fees
+func (ctrl *Controller) SpeedUp(w http.ResponseWriter, r *http.Request) {
+	ctrl.replace(w, r, ctrl.h.SpeedUp, "transaction sped up")
+}
+
+// Cancel returns response for Cancel method, that replaces pending transaction with zero-value self-transfer
+func (ctrl *Controller) Cancel(w http.ResponseWriter, r *http.Request) {
+	ctrl.replace(w, r, ctrl.h.Cancel, "transaction cancellation sent")
+}
+
+func (ctrl *Controller) replace(
+	w http.ResponseWriter,
+	r *http.Request,
+	replace func(context.Context, string) (*blockchain.Transaction, error),
+	msg string,
+) {
+	hash := helper.TrimHexPrefix(r.URL.Query().Get(hashArg))
+	if len(hash) != hashLength || !helper.IsHexString(hash) {
+		errMsg := "invalid request: wrong transaction hash"
+		ctrl.sendError(w, errMsg, "hash", hash)
+		return
+	}
+
+	t, err := replace(r.Context(), "0x"+strings.ToLower(hash))
+	if err != nil {
+		errMsg := "error while replacing transaction: " + err.Error()
+		ctrl.sendError(w, errMsg, "hash", hash, "error", err)
+		return
+	}
+
+	respJSON, err := json.Marshal(&ReplaceResponse{Message: msg, Hash: t.Hash()})
+	if err != nil {
+		errMsg := "error while marshaling response"
+		ctrl.sendError(w, errMsg, "error", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(200)
+	w.Write(respJSON)
+}
+
+// History returns response for History method, that shows all changes of status of transaction
+// by its hash or ID of send request
+func (ctrl *Controller) History(w http.ResponseWriter, r *http.Request) {
+	id := strings.ToLower(helper.TrimHexPrefix(r.URL.Query().Get(idArg)))
+	if id == "" || !helper.IsHexString(id) {
+		errMsg := "invalid request: wrong transaction hash or request ID"
+		ctrl.sendError(w, errMsg, "id", id)
+		return
+	}
+	// Hashes are saved with prefix, request IDs are not
+	if len(id) == hashLength {
+		id = "0x" + id
+	}
+
+	history, err := ctrl.st.LoadHistory(id)
+	if err != nil {
+		errMsg := "error while loading history"
+		ctrl.sendError(w, errMsg, "id", id, "error", err)
+		return
+	}
+
+	response := make([]*HistoryRecord, 0, len(history))
+	for _, tr := range history {
+		response = append(response, &HistoryRecord{
+			Date:       tr.CreatedAt.Format(time.RFC850),
+			RequestID:  tr.RequestID,
+			Hash:       tr.Hash,
+			FromStatus: tr.FromStatus,
+			ToStatus:   tr.ToStatus,
+		})
+	}
+
+	ctrl.sendJSON(w, response)
 }
 
 // GetLast returns response for GetLast method
@@ -102,10 +424,13 @@ func (ctrl *Controller) GetLast(w http.ResponseWriter, r *http.Request) {
 	for _, t := range txs {
 		lastTransaction := &LastTransaction{
 			Date:          t.CreatedAt().Format(time.RFC850),
-			Address:       t.To(),
-			Amount:        helper.BigToHex(t.Value()),
+			Address:       t.Recipient(),
+			Amount:        helper.BigToHex(t.Amount()),
 			Confirmations: t.Confirmations(),
 		}
+		if token, ok := ctrl.bc.Tokens().ByAddress(t.Token()); ok {
+			lastTransaction.Token = token.Symbol()
+		}
 
 		response = append(response, lastTransaction)
 	}
@@ -131,6 +456,21 @@ func (ctrl *Controller) sendError(w http.ResponseWriter, errMsg string, keysAndV
 	ctrl.sendResponse(w, errMsg, false)
 }
 
+// sendUnavailable answers that request can't be handled now and client should retry it later
+func (ctrl *Controller) sendUnavailable(w http.ResponseWriter, errMsg string, keysAndValues ...interface{}) {
+	ctrl.log.Warnw(errMsg, keysAndValues...)
+
+	respJSON, err := json.Marshal(&ErrorResponse{Error: errMsg})
+	if err != nil {
+		ctrl.log.Errorw("error while response marshaling", "err", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.Header().Set("Retry-After", retryAfterSeconds)
+	w.WriteHeader(http.StatusServiceUnavailable)
+	w.Write(respJSON)
+}
+
 func (ctrl *Controller) sendResponse(w http.ResponseWriter, msg string, isSuccess bool) {
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 	w.WriteHeader(200) // success
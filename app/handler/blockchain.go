@@ -0,0 +1,38 @@
+package handler
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/kainobor/eth-client/app/blockchain"
+)
+
+type (
+	// Blockchain is client of network, that is used by handler. It is implemented by blockchain.Client
+	// and can be replaced by fake one in tests
+	Blockchain interface {
+		// Network state
+		GetCurrentBlock(ctx context.Context) (*big.Int, error)
+		GetHeader(ctx context.Context, blockNumber big.Int) (*blockchain.Header, error)
+		GetBlockTransactions(ctx context.Context, blockNumber big.Int) (*blockchain.Header, []*blockchain.Transaction, error)
+		BlockExists(ctx context.Context, blockNumber big.Int, blockHash string) (bool, error)
+		SupportsSubscriptions() bool
+		SubscribeNewHeads(ctx context.Context, ch chan<- *blockchain.Header) (blockchain.Subscription, error)
+		ReconnectWS(ctx context.Context) error
+
+		// Balances
+		GetBalances(ctx context.Context, addrs []string, blockTag string) (map[string]*big.Int, error)
+		GetTokenBalances(ctx context.Context, token *blockchain.Token, addrs []string) (map[string]*big.Int, error)
+		Tokens() *blockchain.TokenRegistry
+
+		// Transactions
+		Nonces() *blockchain.NonceManager
+		SignTransaction(ctx context.Context, t *blockchain.Transaction) error
+		SignReplacement(ctx context.Context, t, prev *blockchain.Transaction) error
+		Rebroadcast(ctx context.Context, t *blockchain.Transaction) (string, error)
+		RenewTransaction(ctx context.Context, t *blockchain.Transaction) error
+		GetReceipt(ctx context.Context, hash string) (*blockchain.Receipt, error)
+	}
+)
+
+var _ Blockchain = (*blockchain.Client)(nil)
@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"context"
 	"fmt"
 	"math/big"
 	"sync"
@@ -8,69 +9,111 @@ import (
 
 	"github.com/kainobor/eth-client/app/blockchain"
 	"github.com/kainobor/eth-client/app/config"
-	"github.com/kainobor/eth-client/app/helper"
 	"github.com/kainobor/eth-client/app/logger"
 	"github.com/kainobor/eth-client/app/storage"
 )
 
 type (
+	// blockCache keeps results of block checks during one round of transactions handling
+	blockCache struct {
+		exists map[string]bool
+		sync.Mutex
+	}
+
 	// Handler of current application data
 	Handler struct {
 		config         *config.HandlerConfig
-		bc             *blockchain.Client
-		st             *storage.Storage
+		bc             Blockchain
+		st             storage.Storage
 		transactions   map[string]*blockchain.Transaction
 		curBlockNumber big.Int
+		newBlocks      chan struct{} // Signals about new current block
+		reorgListeners []func(*blockchain.ReorgEvent)
+		ctx            context.Context  // Lifetime of handling, transactions are processed within it
+		firstSeen      map[string]int64 // Blocks when pending transactions were seen first, used only by stuck checking
+		alerted        map[string]bool  // Stuck transactions, that were already reported, used only by stuck checking
+		broadcasts     *workerPool      // Workers, that send requests from outbox
+		confirms       *workerPool      // Workers, that check blocks and confirmations of transactions
+		checking       map[string]bool  // Transactions, that are waiting for check or being checked
 		log            *logger.Logger
 		sync.RWMutex
 	}
 )
 
 // New handler
-func New(c *config.HandlerConfig, bc *blockchain.Client, st *storage.Storage, log *logger.Logger) *Handler {
+func New(c *config.HandlerConfig, bc Blockchain, st storage.Storage, log *logger.Logger) *Handler {
 	transactions := make(map[string]*blockchain.Transaction)
 
-	return &Handler{config: c, bc: bc, st: st, transactions: transactions, log: log}
+	return &Handler{
+		config:       c,
+		bc:           bc,
+		st:           st,
+		transactions: transactions,
+		newBlocks:    make(chan struct{}, 1),
+		firstSeen:    make(map[string]int64),
+		alerted:      make(map[string]bool),
+		broadcasts:   newWorkerPool(c.OutboxWorkers, c.OutboxQueue),
+		confirms:     newWorkerPool(c.ConfirmWorkers, c.ConfirmQueue),
+		checking:     make(map[string]bool),
+		log:          log,
+	}
 }
 
-// Handle app data and gets it from DB before starting
-func (h *Handler) Handle(cc *config.ConfirmationConfig) error {
+// Handle app data and gets it from DB before starting. Handling is stopped when context is done
+func (h *Handler) Handle(ctx context.Context, cc *config.ConfirmationConfig) error {
 	var err error
 	var curBlockNum *big.Int
-	if curBlockNum, err = h.bc.GetCurrentBlock(); err != nil {
+	if curBlockNum, err = h.bc.GetCurrentBlock(ctx); err != nil {
 		return fmt.Errorf("can't get current block: %v", err)
 	}
 
 	h.SetCurBlockNum(*curBlockNum)
 
-	if h.transactions, err = h.st.LoadTransactionsByStatus(blockchain.PendingStatus); err != nil {
-		return fmt.Errorf("can't load pending transactions: %v", err)
+	if h.transactions, err = h.st.LoadActiveTransactions(); err != nil {
+		return fmt.Errorf("can't load active transactions: %v", err)
 	}
+	if err := h.holdSignedNonces(); err != nil {
+		return err
+	}
+	h.ctx = ctx
 
-	go func() {
-		tcr := time.NewTicker(h.config.TransactionInterval)
-		for range tcr.C {
-			h.handleTransactions(cc.SuccessConfirmationsAmount)
-		}
-	}()
+	h.confirms.start(ctx)
+	go h.runEvery(ctx, h.config.TransactionInterval, func(ctx context.Context) {
+		h.handleTransactions(ctx, cc.SuccessConfirmationsAmount)
+	})
 
-	go func() {
-		tcr := time.NewTicker(h.config.CurBlockInterval)
-		for range tcr.C {
-			h.handleCurrentBlock()
-		}
-	}()
+	go h.watchHeads(ctx)
 
-	go func() {
-		tcr := time.NewTicker(h.config.BalanceInterval)
-		for range tcr.C {
-			h.handleBalances()
-		}
-	}()
+	go h.watchBlocks(ctx)
+
+	go h.runEvery(ctx, h.config.BalanceInterval, h.handleBalances)
+
+	go h.runEvery(ctx, h.config.NonceInterval, h.handleNonces)
+
+	if h.config.StuckInterval > 0 {
+		go h.runEvery(ctx, h.config.StuckInterval, h.handleStuck)
+	}
+
+	h.runOutboxWorkers(ctx)
 
 	return nil
 }
 
+// runEvery calls f on each tick until context is done
+func (h *Handler) runEvery(ctx context.Context, interval time.Duration, f func(context.Context)) {
+	tcr := time.NewTicker(interval)
+	defer tcr.Stop()
+
+	for {
+		select {
+		case <-tcr.C:
+			f(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
 // AddTransaction adds one transaction to handling queue
 func (h *Handler) AddTransaction(t *blockchain.Transaction) {
 	h.Lock()
@@ -78,11 +121,21 @@ func (h *Handler) AddTransaction(t *blockchain.Transaction) {
 	h.Unlock()
 }
 
-// SetCurBlockNum is synchronous setter
+// SetCurBlockNum is synchronous setter, it notifies about new block
 func (h *Handler) SetCurBlockNum(bn big.Int) {
 	h.Lock()
+	isNew := h.curBlockNumber.Cmp(&bn) != 0
 	h.curBlockNumber = bn
 	h.Unlock()
+
+	if !isNew {
+		return
+	}
+
+	select {
+	case h.newBlocks <- struct{}{}:
+	default:
+	}
 }
 
 // CurBlockNum is synchronous getter
@@ -94,47 +147,195 @@ func (h *Handler) CurBlockNum() big.Int {
 
 }
 
-func (h *Handler) handleTransactions(confirmationsForSuccess int64) {
-	var existBlocks = make(map[string]bool)
+// handleTransactions puts tracked transactions to queue of confirmation workers. Transactions,
+// that have no place in queue, are checked on next round
+func (h *Handler) handleTransactions(ctx context.Context, confirmationsForSuccess int64) {
+	blocks := &blockCache{exists: make(map[string]bool)}
 
 	// Remember, that copy have the same pointers!
 	copyMap := h.copyTransactions()
 
 	for hash, t := range copyMap {
-		exist, err := h.checkBlockExistense(existBlocks, t)
-		if err != nil {
-			h.log.Errorw(err.Error(), "transaction", t)
-		}
-		if !exist {
+		if !h.startChecking(hash) {
 			continue
 		}
 
-		confirmations := h.currentTransactionConfirmations(t)
-		if confirmations != t.Confirmations() {
-			if err := h.st.UpdateConfirmations(t.ID(), confirmations); err != nil {
-				h.log.Errorw("can't update confirmation", "error", err)
-				continue
+		hash, t := hash, t
+		err := h.confirms.submit(func(ctx context.Context) {
+			defer h.finishChecking(hash)
+			h.handleTransaction(ctx, t, blocks, confirmationsForSuccess)
+		})
+		if err != nil {
+			h.finishChecking(hash)
+			h.log.Warnw("confirmation queue is full, transactions are postponed", "transactions", len(copyMap))
+			return
+		}
+	}
+}
+
+// handleTransaction updates block, confirmations and status of one transaction
+func (h *Handler) handleTransaction(ctx context.Context, t *blockchain.Transaction, blocks *blockCache, confirmationsForSuccess int64) {
+	// Transaction is returned to queue without block after reorganization
+	if !t.IsMined() {
+		if err := h.bc.RenewTransaction(ctx, t); err == nil && t.IsMined() {
+			if err := h.saveMined(t); err != nil {
+				h.log.Errorw("can't update transaction block", "transaction", t, "error", err)
 			}
+		}
+		return
+	}
 
-			t.SetConfirmations(confirmations)
-			// Balance may to change if some block before current was cancelled
-			h.updateBalances(t)
+	// Block of transaction, that is loaded or renewed somewhere else, is saved before confirmations are counted,
+	// otherwise transaction can't become confirmed
+	if blockchain.IsPending(t.Status()) {
+		if err := h.saveMined(t); err != nil {
+			h.log.Errorw("can't update transaction block", "transaction", t, "error", err)
+			return
 		}
+	}
+
+	exist, err := h.checkBlockExistense(ctx, blocks, t)
+	if err != nil {
+		h.log.Errorw(err.Error(), "transaction", t)
+	}
+	if !exist {
+		return
+	}
+
+	confirmations := h.currentTransactionConfirmations(t)
+	if confirmations != t.Confirmations() {
+		if err := h.st.UpdateConfirmations(t.ID(), confirmations); err != nil {
+			h.log.Errorw("can't update confirmation", "error", err)
+			return
+		}
+
+		t.SetConfirmations(confirmations)
+		// Balance may to change if some block before current was cancelled
+		h.updateBalances(ctx, t)
+	}
 
-		if confirmations > confirmationsForSuccess {
-			if err := h.st.UpdateTransactionStatus(t.ID(), blockchain.SuccessStatus); err != nil {
-				h.log.Errorw("can't update transaction status", "error", err)
+	if confirmations > confirmationsForSuccess {
+		status, err := h.resolveStatus(ctx, t)
+		if err != nil {
+			h.log.Errorw("can't resolve transaction status", "transaction", t, "error", err)
+			return
+		}
+
+		if err := h.transit(t, status, "", saveStatus(t)); err != nil {
+			h.log.Errorw("can't update transaction status", "error", err)
+			return
+		}
+
+		h.delTransaction(t.Hash())
+		h.resolveReplacements(t)
+	}
+}
+
+// startChecking marks transaction as being checked, false is returned if it is checked already
+func (h *Handler) startChecking(hash string) bool {
+	h.Lock()
+	defer h.Unlock()
+
+	if h.checking[hash] {
+		return false
+	}
+	h.checking[hash] = true
+
+	return true
+}
+
+// finishChecking allows to check transaction again
+func (h *Handler) finishChecking(hash string) {
+	h.Lock()
+	delete(h.checking, hash)
+	h.Unlock()
+}
+
+// watchHeads receives new blocks through subscription and falls back
+// to polling while node doesn't support subscriptions or connection is lost
+func (h *Handler) watchHeads(ctx context.Context) {
+	if !h.bc.SupportsSubscriptions() {
+		h.runEvery(ctx, h.config.CurBlockInterval, h.handleCurrentBlock)
+		return
+	}
+
+	for ctx.Err() == nil {
+		if err := h.subscribeHeads(ctx); err != nil {
+			h.log.Errorw("new heads subscription failed", "error", err)
+		}
+
+		h.pollUntilReconnect(ctx)
+	}
+}
+
+// subscribeHeads handles new heads until subscription fails
+func (h *Handler) subscribeHeads(ctx context.Context) error {
+	heads := make(chan *blockchain.Header)
+	sub, err := h.bc.SubscribeNewHeads(ctx, heads)
+	if err != nil {
+		return err
+	}
+	defer sub.Unsubscribe()
+
+	for {
+		select {
+		case head := <-heads:
+			h.SetCurBlockNum(head.Number())
+		case err := <-sub.Err():
+			return err
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// pollUntilReconnect polls current block and tries to reconnect websocket
+func (h *Handler) pollUntilReconnect(ctx context.Context) {
+	tcr := time.NewTicker(h.config.CurBlockInterval)
+	defer tcr.Stop()
+	reconnect := time.After(h.config.ReconnectInterval)
+
+	for {
+		select {
+		case <-tcr.C:
+			h.handleCurrentBlock(ctx)
+		case <-reconnect:
+			if err := h.bc.ReconnectWS(ctx); err != nil {
+				h.log.Errorw("can't reconnect websocket", "error", err)
+				reconnect = time.After(h.config.ReconnectInterval)
 				continue
 			}
-
-			t.SetStatus(blockchain.SuccessStatus)
-			h.delTransaction(hash)
+			return
+		case <-ctx.Done():
+			return
 		}
 	}
 }
 
-func (h *Handler) handleCurrentBlock() {
-	num, err := h.bc.GetCurrentBlock()
+// resolveStatus gets receipt of confirmed transaction, saves it and returns final status
+func (h *Handler) resolveStatus(ctx context.Context, t *blockchain.Transaction) (string, error) {
+	receipt, err := h.bc.GetReceipt(ctx, t.Hash())
+	if err != nil {
+		return "", err
+	} else if receipt == nil {
+		return "", fmt.Errorf("no receipt for transaction `%s`", t.Hash())
+	}
+
+	if err := h.st.SaveReceipt(t.ID(), receipt); err != nil {
+		return "", fmt.Errorf("can't save receipt: %v", err)
+	}
+
+	if !receipt.StatusKnown() {
+		h.log.Warnw("receipt has no status, transaction is treated as successful", "hash", t.Hash())
+	} else if !receipt.Success() {
+		return blockchain.RevertedStatus, nil
+	}
+
+	return blockchain.ConfirmedStatus, nil
+}
+
+func (h *Handler) handleCurrentBlock(ctx context.Context) {
+	num, err := h.bc.GetCurrentBlock(ctx)
 	if err != nil {
 		h.log.Errorw("error while getting current block number", "error", err)
 		return
@@ -143,53 +344,121 @@ func (h *Handler) handleCurrentBlock() {
 	h.SetCurBlockNum(*num)
 }
 
-func (h *Handler) handleBalances() {
-	for {
-		balMap, err := h.st.LoadAllBalances()
-		if err != nil {
-			h.log.Errorw("can't load balances", "err", err)
+// handleBalances refreshes all known balances with batch requests
+func (h *Handler) handleBalances(ctx context.Context) {
+	balMap, err := h.st.LoadAllBalances()
+	if err != nil {
+		h.log.Errorw("can't load balances", "err", err)
+		return
+	}
+
+	addrs := make([]string, 0, len(balMap))
+	for addr := range balMap {
+		addrs = append(addrs, addr)
+	}
+
+	newBalances, err := h.bc.GetBalances(ctx, addrs, "latest")
+	if err != nil {
+		// Balances that were got are still saved
+		h.log.Errorw("can't get balances from blockchain", "err", err)
+	}
+
+	for addr, newBal := range newBalances {
+		if newBal.Cmp(balMap[addr]) == 0 {
 			continue
 		}
 
-		for addr, bal := range balMap {
-			newBal, err := h.bc.GetBalance(addr)
-			if err != nil {
-				h.log.Errorw("can't get balance from blockchain", "addr", addr, "err", err)
-				continue
-			}
+		if err := h.st.UpsertBalance(addr, newBal); err != nil {
+			h.log.Errorw("can't upsert balance", "addr", addr, "balance", newBal, "err", err)
+		}
+	}
 
-			if newBal.Cmp(bal) == 0 {
-				continue
-			}
+	for _, token := range h.bc.Tokens().All() {
+		h.handleTokenBalances(ctx, token)
+	}
+}
 
-			balString := helper.BigToHex(*newBal)
-			if err := h.st.UpsertBalance(addr, balString); err != nil {
-				h.log.Errorw("can't upsert balance", "addr", addr, "balance", balString, "err", err)
-			}
+// handleTokenBalances refreshes balances of one token for all known addresses
+func (h *Handler) handleTokenBalances(ctx context.Context, token *blockchain.Token) {
+	balMap, err := h.st.LoadTokenBalances(token.Address())
+	if err != nil {
+		h.log.Errorw("can't load token balances", "token", token.Symbol(), "err", err)
+		return
+	}
+
+	addrs := make([]string, 0, len(balMap))
+	for addr := range balMap {
+		addrs = append(addrs, addr)
+	}
+
+	newBalances, err := h.bc.GetTokenBalances(ctx, token, addrs)
+	if err != nil {
+		h.log.Errorw("can't get token balances from blockchain", "token", token.Symbol(), "err", err)
+	}
+
+	for addr, newBal := range newBalances {
+		if newBal.Cmp(balMap[addr]) == 0 {
+			continue
+		}
+
+		if err := h.st.UpsertTokenBalance(addr, token.Address(), newBal); err != nil {
+			h.log.Errorw("can't upsert token balance", "addr", addr, "token", token.Symbol(), "balance", newBal, "err", err)
 		}
 	}
 }
 
-// updateBalances gets sender and receiver balances from network and saves it to DB
-func (h *Handler) updateBalances(t *blockchain.Transaction) error {
-	fromBal, err := h.bc.GetBalance(t.From())
-	if err != nil {
-		return fmt.Errorf("can't get sender balance: %v", err)
+// handleNonces finds nonces, that were given out but never reached network,
+// and resets counters of their senders for filling the gaps
+func (h *Handler) handleNonces(ctx context.Context) {
+	nonces := h.bc.Nonces()
+	for _, addr := range nonces.Senders() {
+		gaps, err := nonces.Gaps(ctx, addr)
+		if err != nil {
+			h.log.Errorw("can't check nonce gaps", "addr", addr, "err", err)
+			continue
+		}
+
+		if len(gaps) == 0 {
+			continue
+		}
+
+		h.log.Warnw("nonce gaps detected", "addr", addr, "gaps", gaps)
+		nonces.Reset(addr)
 	}
+}
 
-	toBal, err := h.bc.GetBalance(t.To())
+// updateBalances gets sender and receiver balances from network and saves it to DB
+func (h *Handler) updateBalances(ctx context.Context, t *blockchain.Transaction) error {
+	addrs := []string{t.From(), t.Recipient()}
+	balances, err := h.bc.GetBalances(ctx, addrs, "latest")
 	if err != nil {
-		return fmt.Errorf("can't get receiver balance: %v", err)
+		return fmt.Errorf("can't get balances: %v", err)
 	}
 
-	if err := h.st.UpsertBalance(t.From(), helper.BigToHex(*fromBal)); err != nil {
+	if err := h.st.UpsertBalance(t.From(), balances[t.From()]); err != nil {
 		return fmt.Errorf("can't update sender balance: %v", err)
 	}
 
-	if err := h.st.UpsertBalance(t.To(), helper.BigToHex(*toBal)); err != nil {
+	if err := h.st.UpsertBalance(t.Recipient(), balances[t.Recipient()]); err != nil {
 		return fmt.Errorf("can't update receiver balance: %v", err)
 	}
 
+	token, ok := h.bc.Tokens().ByAddress(t.Token())
+	if !ok {
+		return nil
+	}
+
+	tokenBalances, err := h.bc.GetTokenBalances(ctx, token, addrs)
+	if err != nil {
+		return fmt.Errorf("can't get token balances: %v", err)
+	}
+
+	for addr, bal := range tokenBalances {
+		if err := h.st.UpsertTokenBalance(addr, token.Address(), bal); err != nil {
+			return fmt.Errorf("can't update token balance: %v", err)
+		}
+	}
+
 	return nil
 }
 
@@ -205,32 +474,64 @@ func (h *Handler) copyTransactions() map[string]*blockchain.Transaction {
 	return m
 }
 
+func (h *Handler) hasTransaction(hash string) bool {
+	h.RLock()
+	defer h.RUnlock()
+
+	_, ok := h.transactions[hash]
+
+	return ok
+}
+
+func (h *Handler) getTransaction(hash string) (*blockchain.Transaction, bool) {
+	h.RLock()
+	defer h.RUnlock()
+
+	t, ok := h.transactions[hash]
+
+	return t, ok
+}
+
 func (h *Handler) delTransaction(hash string) {
 	h.Lock()
 	delete(h.transactions, hash)
 	h.Unlock()
 }
 
-func (h *Handler) checkBlockExistense(existBlocks map[string]bool, t *blockchain.Transaction) (bool, error) {
-	var err error
-	blockExist, ok := existBlocks[t.BlockHash()]
+func (c *blockCache) get(hash string) (bool, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	exists, ok := c.exists[hash]
+
+	return exists, ok
+}
+
+func (c *blockCache) set(hash string, exists bool) {
+	c.Lock()
+	c.exists[hash] = exists
+	c.Unlock()
+}
+
+func (h *Handler) checkBlockExistense(ctx context.Context, blocks *blockCache, t *blockchain.Transaction) (bool, error) {
+	blockExist, ok := blocks.get(t.BlockHash())
 
 	if !ok {
-		if blockExist, err = h.bc.BlockExists(t.BlockNumber(), t.BlockHash()); err != nil {
+		var err error
+		if blockExist, err = h.bc.BlockExists(ctx, t.BlockNumber(), t.BlockHash()); err != nil {
 			return false, fmt.Errorf("can't check is block exists: %v", err)
 		}
-		existBlocks[t.BlockHash()] = blockExist
+		blocks.set(t.BlockHash(), blockExist)
 	}
 
+	// Transaction from cancelled block may be included in another one
 	if !blockExist {
-		if err := h.st.UpdateTransactionStatus(t.ID(), blockchain.FailStatus); err != nil {
-			return false, fmt.Errorf("can't set transaction failure: %v", err)
+		if err := h.reincludeTransaction(ctx, t); err != nil {
+			return false, fmt.Errorf("can't re-resolve transaction block: %v", err)
 		}
-		t.SetStatus(blockchain.FailStatus)
-		h.delTransaction(t.Hash())
 
 		// Balance may to change if block is cancelled
-		h.updateBalances(t)
+		h.updateBalances(ctx, t)
 		return false, nil
 	}
 
@@ -245,33 +546,16 @@ func (h *Handler) currentTransactionConfirmations(t *blockchain.Transaction) int
 	return curConfirmationsBig.Sub(&curBlock, &transBlock).Int64()
 }
 
-func (h *Handler) ProcessTransaction(t *blockchain.Transaction) {
-	var txHash string
-	txHash, err := h.bc.SendTransaction(t)
-	if err != nil {
-		h.log.Errorw("error while sending transaction", "transaction", t, "error", err)
-		return
-	}
-	t.SetHash(txHash)
-
-	// For getting information about block
-	if err = h.bc.RenewTransaction(t); err != nil {
-		h.log.Errorw("error while renewing transaction", "transaction", t, "error", err)
-		return
+// saveTransaction saves sent transaction as entry and withdraw one. It is called with storage of transaction,
+// so both rows are saved together
+func saveTransaction(st storage.Storage, t *blockchain.Transaction) error {
+	if err := st.SaveEntryTransaction(t); err != nil {
+		return fmt.Errorf("error while saving entry transaction: %v", err)
 	}
-	t.FixateCreatedAt()
 
-	h.saveTransaction(t)
-}
-
-func (h *Handler) saveTransaction(t *blockchain.Transaction) {
-	if err := h.st.SaveEntryTransaction(t); err != nil {
-		h.log.Errorw("error while saving entry transaction", "transaction", t, "error", err)
+	if err := st.SaveWithdrawTransaction(t); err != nil {
+		return fmt.Errorf("error while saving withdraw transaction: %v", err)
 	}
 
-	if err := h.st.SaveWithdrawTransaction(t); err != nil {
-		h.log.Errorw("error while saving withdraw transaction", "transaction", t, "error", err)
-	}
-
-	h.AddTransaction(t)
+	return nil
 }
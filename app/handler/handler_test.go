@@ -0,0 +1,353 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/kainobor/eth-client/app/blockchain"
+	"github.com/kainobor/eth-client/app/config"
+	"github.com/kainobor/eth-client/app/logger"
+	"github.com/kainobor/eth-client/app/storage"
+	"github.com/kainobor/eth-client/app/storage/memory"
+	"go.uber.org/zap"
+)
+
+const (
+	testFrom            = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	testTo              = "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+	testHash            = "0x01"
+	testReplacementHash = "0x02"
+	testBlock           = "0xb1"
+
+	confirmationsForSuccess = 3
+)
+
+// fakeChain is network, where transactions are mined in blocks from map. Methods, that are not
+// needed for confirmation checks, are not implemented
+type fakeChain struct {
+	Blockchain
+	mined   map[string]int64 // Numbers of blocks of mined transactions by hashes
+	removed map[string]bool  // Blocks, that left main chain
+	sendErr error            // Error of sending signed transactions
+	status  *string          // Status of receipts, "0x1" if nil, absent if empty
+}
+
+func (c *fakeChain) SignReplacement(ctx context.Context, t, prev *blockchain.Transaction) error {
+	t.SetNonce(prev.Nonce())
+	t.SetRaw([]byte{2})
+	t.SetHash(testReplacementHash)
+
+	return nil
+}
+
+func (c *fakeChain) Rebroadcast(ctx context.Context, t *blockchain.Transaction) (string, error) {
+	if c.sendErr != nil {
+		return "", c.sendErr
+	}
+
+	return t.Hash(), nil
+}
+
+func (c *fakeChain) BlockExists(ctx context.Context, blockNumber big.Int, blockHash string) (bool, error) {
+	return !c.removed[blockHash], nil
+}
+
+func (c *fakeChain) RenewTransaction(ctx context.Context, t *blockchain.Transaction) error {
+	number, ok := c.mined[t.Hash()]
+	if !ok {
+		return blockchain.ErrTransactionNotFound
+	}
+
+	return json.Unmarshal(minedJSON(t.Hash(), number), t)
+}
+
+func (c *fakeChain) GetReceipt(ctx context.Context, hash string) (*blockchain.Receipt, error) {
+	number, ok := c.mined[hash]
+	if !ok {
+		return nil, nil
+	}
+
+	status := `"status":"0x1",`
+	if c.status != nil && *c.status == "" {
+		status = ""
+	} else if c.status != nil {
+		status = fmt.Sprintf(`"status":"%s",`, *c.status)
+	}
+
+	receipt := new(blockchain.Receipt)
+	data := fmt.Sprintf(`{%s"gasUsed":"0x5208","blockHash":"%s","blockNumber":"0x%x"}`, status, testBlock, number)
+
+	return receipt, json.Unmarshal([]byte(data), receipt)
+}
+
+func (c *fakeChain) GetBalances(ctx context.Context, addrs []string, blockTag string) (map[string]*big.Int, error) {
+	balances := make(map[string]*big.Int)
+	for _, addr := range addrs {
+		balances[addr] = big.NewInt(0)
+	}
+
+	return balances, nil
+}
+
+func (c *fakeChain) Tokens() *blockchain.TokenRegistry {
+	return blockchain.NewTokenRegistry(nil)
+}
+
+func TestMinedTransactionIsConfirmed(t *testing.T) {
+	chain := &fakeChain{mined: map[string]int64{testHash: 10}}
+	h, st := newTestHandler(t, chain, 20)
+	tx := sentTransaction(t, st)
+	h.AddTransaction(tx)
+
+	// The first check finds block of transaction
+	h.handleTransaction(context.Background(), tx, newBlockCache(), confirmationsForSuccess)
+	if tx.Status() != blockchain.MinedStatus || !tx.IsMined() {
+		t.Fatalf("expected mined transaction, got status `%s`", tx.Status())
+	}
+	after, err := st.LoadTransactionsAfterBlock(9)
+	must(t, err)
+	if _, ok := after[testHash]; !ok {
+		t.Error("block of mined transaction is not saved")
+	}
+
+	// The second one counts confirmations
+	h.handleTransaction(context.Background(), tx, newBlockCache(), confirmationsForSuccess)
+	if tx.Status() != blockchain.ConfirmedStatus {
+		t.Fatalf("expected confirmed transaction, got status `%s`", tx.Status())
+	}
+	if h.hasTransaction(testHash) {
+		t.Error("confirmed transaction is still tracked")
+	}
+	checkHistory(t, st, testHash, blockchain.BroadcastStatus, blockchain.MinedStatus, blockchain.ConfirmedStatus)
+}
+
+func TestFinalStatusByReceipt(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   string
+		expected string
+	}{
+		{name: "success", status: "0x1", expected: blockchain.ConfirmedStatus},
+		{name: "reverted", status: "0x0", expected: blockchain.RevertedStatus},
+		{name: "receipt without status", status: "", expected: blockchain.ConfirmedStatus},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := tt.status
+			chain := &fakeChain{mined: map[string]int64{testHash: 10}, status: &status}
+			h, st := newTestHandler(t, chain, 20)
+			tx := sentTransaction(t, st)
+			h.AddTransaction(tx)
+
+			h.handleTransaction(context.Background(), tx, newBlockCache(), confirmationsForSuccess)
+			h.handleTransaction(context.Background(), tx, newBlockCache(), confirmationsForSuccess)
+			if tx.Status() != tt.expected {
+				t.Errorf("expected status `%s`, got `%s`", tt.expected, tx.Status())
+			}
+		})
+	}
+}
+
+func TestTransactionWithUnsavedBlockIsConfirmed(t *testing.T) {
+	chain := &fakeChain{mined: map[string]int64{testHash: 10}}
+	h, st := newTestHandler(t, chain, 20)
+	tx := sentTransaction(t, st)
+
+	// Block is got by other check, but it is not saved
+	must(t, chain.RenewTransaction(context.Background(), tx))
+	h.AddTransaction(tx)
+
+	h.handleTransaction(context.Background(), tx, newBlockCache(), confirmationsForSuccess)
+	if tx.Status() != blockchain.ConfirmedStatus {
+		t.Fatalf("expected confirmed transaction, got status `%s`", tx.Status())
+	}
+	checkHistory(t, st, testHash, blockchain.BroadcastStatus, blockchain.MinedStatus, blockchain.ConfirmedStatus)
+}
+
+func TestTransactionWithoutEnoughConfirmationsIsMined(t *testing.T) {
+	chain := &fakeChain{mined: map[string]int64{testHash: 19}}
+	h, st := newTestHandler(t, chain, 20)
+	tx := sentTransaction(t, st)
+	h.AddTransaction(tx)
+
+	h.handleTransaction(context.Background(), tx, newBlockCache(), confirmationsForSuccess)
+	h.handleTransaction(context.Background(), tx, newBlockCache(), confirmationsForSuccess)
+	if tx.Status() != blockchain.MinedStatus || tx.Confirmations() != 1 {
+		t.Errorf("expected mined transaction with 1 confirmation, got status `%s` and %d", tx.Status(), tx.Confirmations())
+	}
+	if !h.hasTransaction(testHash) {
+		t.Error("mined transaction is not tracked")
+	}
+}
+
+func TestTransactionFromRemovedBlockIsReorged(t *testing.T) {
+	chain := &fakeChain{mined: map[string]int64{testHash: 10}, removed: make(map[string]bool)}
+	h, st := newTestHandler(t, chain, 20)
+	tx := sentTransaction(t, st)
+	h.AddTransaction(tx)
+	h.handleTransaction(context.Background(), tx, newBlockCache(), confirmationsForSuccess)
+
+	// Block leaves main chain, and transaction is not mined in other one yet
+	chain.removed[testBlock] = true
+	delete(chain.mined, testHash)
+	h.handleTransaction(context.Background(), tx, newBlockCache(), confirmationsForSuccess)
+	if tx.Status() != blockchain.ReorgedStatus || tx.IsMined() {
+		t.Fatalf("expected reorged transaction without block, got status `%s`", tx.Status())
+	}
+	if !h.hasTransaction(testHash) {
+		t.Error("reorged transaction is not tracked")
+	}
+	checkHistory(t, st, testHash, blockchain.BroadcastStatus, blockchain.MinedStatus, blockchain.ReorgedStatus)
+}
+
+func TestReplacementIsSavedBeforeSending(t *testing.T) {
+	chain := &fakeChain{}
+	h, st := newTestHandler(t, chain, 20)
+	tx := sentTransaction(t, st)
+	h.AddTransaction(tx)
+
+	replacement, err := h.SpeedUp(context.Background(), testHash)
+	must(t, err)
+	if replacement.Status() != blockchain.BroadcastStatus || !h.hasTransaction(testReplacementHash) {
+		t.Errorf("expected tracked broadcast replacement, got status `%s`", replacement.Status())
+	}
+
+	last, ok, err := st.LoadLastInChain(testHash)
+	must(t, err)
+	if !ok || last.Hash() != testReplacementHash || last.Status() != blockchain.BroadcastStatus {
+		t.Fatal("replacement is not saved as the last transaction of chain")
+	}
+	checkHistory(t, st, testReplacementHash, blockchain.SignedStatus, blockchain.BroadcastStatus)
+}
+
+func TestNotSentReplacementIsDropped(t *testing.T) {
+	chain := &fakeChain{sendErr: fmt.Errorf("connection refused")}
+	h, st := newTestHandler(t, chain, 20)
+	tx := sentTransaction(t, st)
+	h.AddTransaction(tx)
+
+	if _, err := h.SpeedUp(context.Background(), testHash); err == nil {
+		t.Fatal("expected error of sending")
+	}
+
+	// Node could get transaction before error, so it is tracked and sent again by stuck check
+	last, ok, err := st.LoadLastInChain(testHash)
+	must(t, err)
+	if !ok || last.Hash() != testReplacementHash || last.Status() != blockchain.DroppedStatus {
+		t.Fatal("not sent replacement is not saved as dropped one")
+	}
+	if !h.hasTransaction(testReplacementHash) {
+		t.Error("not sent replacement is not tracked")
+	}
+	checkHistory(t, st, testReplacementHash, blockchain.SignedStatus, blockchain.DroppedStatus)
+}
+
+func TestEnqueuedRequestIsSavedWithHistory(t *testing.T) {
+	h, st := newTestHandler(t, &fakeChain{}, 20)
+	tx, err := blockchain.NewTransaction(testFrom, testTo, "0x1")
+	must(t, err)
+
+	req, err := h.Enqueue(tx, "client", "key")
+	must(t, err)
+	if tx.Status() != blockchain.QueuedStatus {
+		t.Errorf("expected queued transaction, got status `%s`", tx.Status())
+	}
+	checkHistory(t, st, req.RequestID, blockchain.QueuedStatus)
+
+	// Repeated request gets the first one without new history
+	tx, err = blockchain.NewTransaction(testFrom, testTo, "0x1")
+	must(t, err)
+	repeated, err := h.Enqueue(tx, "client", "key")
+	must(t, err)
+	if repeated.RequestID != req.RequestID {
+		t.Errorf("expected request `%s`, got `%s`", req.RequestID, repeated.RequestID)
+	}
+	checkHistory(t, st, req.RequestID, blockchain.QueuedStatus)
+}
+
+func TestReplacedTransactionHasHistory(t *testing.T) {
+	h, st := newTestHandler(t, &fakeChain{}, 20)
+	tx := sentTransaction(t, st)
+	h.AddTransaction(tx)
+
+	replacement, err := h.SpeedUp(context.Background(), testHash)
+	must(t, err)
+	h.resolveReplacements(replacement)
+
+	if tx.Status() != blockchain.ReplacedStatus || h.hasTransaction(testHash) {
+		t.Errorf("expected not tracked replaced transaction, got status `%s`", tx.Status())
+	}
+	checkHistory(t, st, testHash, blockchain.BroadcastStatus, blockchain.ReplacedStatus)
+}
+
+func TestNotReorgedTransactionKeepsBlock(t *testing.T) {
+	chain := &fakeChain{mined: map[string]int64{testHash: 10}}
+	h, st := newTestHandler(t, chain, 20)
+	tx := sentTransaction(t, st)
+	must(t, chain.RenewTransaction(context.Background(), tx))
+
+	// Broadcast transaction can't become reorged
+	if err := h.reincludeTransaction(context.Background(), tx); err == nil {
+		t.Fatal("expected error of not allowed transition")
+	}
+	if !tx.IsMined() || tx.BlockHash() != testBlock {
+		t.Error("block of transaction is lost")
+	}
+}
+
+func newTestHandler(t *testing.T, chain *fakeChain, curBlock int64) (*Handler, storage.Storage) {
+	st := memory.New()
+	h := New(&config.HandlerConfig{}, chain, st, &logger.Logger{SugaredLogger: zap.NewNop().Sugar()})
+	h.SetCurBlockNum(*big.NewInt(curBlock))
+
+	return h, st
+}
+
+// sentTransaction returns transaction, that is saved as broadcast one
+func sentTransaction(t *testing.T, st storage.Storage) *blockchain.Transaction {
+	tx, err := blockchain.NewTransaction(testFrom, testTo, "0x1")
+	must(t, err)
+	tx.SetHash(testHash)
+	tx.SetStatus(blockchain.BroadcastStatus)
+	tx.FixateCreatedAt()
+	must(t, saveTransaction(st, tx))
+	must(t, st.SaveTransition(&blockchain.Transition{Hash: testHash, ToStatus: blockchain.BroadcastStatus}))
+
+	return tx
+}
+
+func minedJSON(hash string, number int64) []byte {
+	return []byte(fmt.Sprintf(
+		`{"hash":"%s","blockHash":"%s","blockNumber":"0x%x","from":"0x%s","to":"0x%s","value":"0x1"}`,
+		hash, testBlock, number, testFrom, testTo,
+	))
+}
+
+func newBlockCache() *blockCache {
+	return &blockCache{exists: make(map[string]bool)}
+}
+
+func checkHistory(t *testing.T, st storage.Storage, hash string, statuses ...string) {
+	t.Helper()
+	history, err := st.LoadHistory(hash)
+	must(t, err)
+	if len(history) != len(statuses) {
+		t.Fatalf("expected %d changes of status, got %d", len(statuses), len(history))
+	}
+	for i, tr := range history {
+		if tr.ToStatus != statuses[i] {
+			t.Errorf("expected status `%s` in change %d, got `%s`", statuses[i], i, tr.ToStatus)
+		}
+	}
+}
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"github.com/kainobor/eth-client/app/blockchain"
+	"github.com/kainobor/eth-client/app/storage"
+)
+
+// transit changes status of transaction, saves it with save func and records transition to history.
+// Save func and history work in one transaction of storage, so status is never saved without its history.
+// Status stays the same if transition is not allowed or saving failed
+func (h *Handler) transit(t *blockchain.Transaction, status, requestID string, save func(tx storage.Storage) error) error {
+	tr, err := blockchain.NewTransition(t.Hash(), t.Status(), status)
+	if err != nil {
+		return err
+	}
+	tr.RequestID = requestID
+
+	prev := t.Status()
+	t.SetStatus(status)
+	err = h.st.WithTx(func(tx storage.Storage) error {
+		if err := save(tx); err != nil {
+			return err
+		}
+
+		return tx.SaveTransition(tr)
+	})
+	if err != nil {
+		t.SetStatus(prev)
+		return err
+	}
+
+	return nil
+}
+
+// recordTransition saves transition to history. Status is already changed, so failed saving is only reported
+func (h *Handler) recordTransition(tr *blockchain.Transition) {
+	if err := h.st.SaveTransition(tr); err != nil {
+		h.log.Errorw("can't save transition to history", "hash", tr.Hash, "request", tr.RequestID, "fromStatus", tr.FromStatus, "toStatus", tr.ToStatus, "error", err)
+	}
+}
+
+// saveStatus returns save func for transit, that updates status of saved transaction
+func saveStatus(t *blockchain.Transaction) func(tx storage.Storage) error {
+	return func(tx storage.Storage) error {
+		return tx.UpdateTransactionStatus(t.ID(), t.Status())
+	}
+}
+
+// saveMined moves transaction, that was found in block, to mined status. Block is removed from transaction,
+// if it is not saved, so transaction is searched in block again on next check instead of being mined only in memory
+func (h *Handler) saveMined(t *blockchain.Transaction) error {
+	if err := h.transit(t, blockchain.MinedStatus, "", saveBlock(t)); err != nil {
+		t.ResetBlock()
+		return err
+	}
+
+	return nil
+}
+
+// saveBlock returns save func for transit, that updates block and status of saved transaction
+func saveBlock(t *blockchain.Transaction) func(tx storage.Storage) error {
+	return func(tx storage.Storage) error {
+		return tx.UpdateTransactionBlock(t)
+	}
+}
@@ -0,0 +1,276 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kainobor/eth-client/app/blockchain"
+	"github.com/kainobor/eth-client/app/helper"
+	"github.com/kainobor/eth-client/app/storage"
+)
+
+const (
+	// requestIDLength is amount of random bytes in ID of send request
+	requestIDLength = 16
+	// defaultOutboxLease is used if lease of outbox requests is not configured
+	defaultOutboxLease = time.Minute
+)
+
+// ErrIdempotencyConflict is returned when idempotency key is reused for request with other params
+var ErrIdempotencyConflict = errors.New("idempotency key is already used for another request")
+
+// Enqueue saves transaction to outbox and returns send request. Transaction is signed
+// and sent later by outbox workers, so accepted request survives restart.
+// If client already sent request with the same idempotency key, that request is returned
+func (h *Handler) Enqueue(t *blockchain.Transaction, clientID, key string) (*storage.SendRequest, error) {
+	b := make([]byte, requestIDLength)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("can't generate request ID: %v", err)
+	}
+
+	req := &storage.SendRequest{
+		RequestID:   hex.EncodeToString(b),
+		ClientID:    clientID,
+		Transaction: t,
+	}
+	if key != "" {
+		req.IdempotencyKey = key
+		req.PayloadHash = payloadHash(t)
+	}
+
+	tr, err := blockchain.NewTransition(t.Hash(), t.Status(), blockchain.QueuedStatus)
+	if err != nil {
+		return nil, err
+	}
+	tr.RequestID = req.RequestID
+
+	// Request and its first status are saved together
+	var added bool
+	err = h.st.WithTx(func(tx storage.Storage) error {
+		if added, err = tx.AddSendRequest(req); err != nil || !added {
+			return err
+		}
+
+		return tx.SaveTransition(tr)
+	})
+	if err != nil {
+		return nil, err
+	} else if added {
+		t.SetStatus(blockchain.QueuedStatus)
+		return req, nil
+	}
+
+	// The same request was added concurrently with this one
+	existing, ok, err := h.FindSendRequest(t, clientID, key)
+	if err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, fmt.Errorf("request with idempotency key `%s` is not found", key)
+	}
+
+	return existing, nil
+}
+
+// FindSendRequest returns request of client with idempotency key, ErrIdempotencyConflict
+// is returned if found request transfers something else than transaction
+func (h *Handler) FindSendRequest(t *blockchain.Transaction, clientID, key string) (*storage.SendRequest, bool, error) {
+	req, ok, err := h.st.LoadSendRequestByKey(clientID, key)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+
+	if req.PayloadHash != payloadHash(t) {
+		return nil, false, ErrIdempotencyConflict
+	}
+
+	return req, true, nil
+}
+
+// payloadHash returns hash of params, that define transfer
+func payloadHash(t *blockchain.Transaction) string {
+	payload := strings.Join([]string{
+		strings.ToLower(helper.TrimHexPrefix(t.From())),
+		strings.ToLower(helper.TrimHexPrefix(t.Recipient())),
+		helper.BigToHex(t.Amount()),
+		strings.ToLower(t.Token()),
+	}, ":")
+	hash := sha256.Sum256([]byte(payload))
+
+	return hex.EncodeToString(hash[:])
+}
+
+// CheckCapacity returns ErrQueueFull if outbox has too many unsent requests, so new requests must be postponed.
+// Busy workers don't reject requests, because outbox keeps them until workers are free
+func (h *Handler) CheckCapacity() error {
+	if h.config.OutboxLimit <= 0 {
+		return nil
+	}
+
+	count, err := h.st.CountUnsentRequests()
+	if err != nil {
+		return err
+	} else if count >= h.config.OutboxLimit {
+		return ErrQueueFull
+	}
+
+	return nil
+}
+
+// runOutboxWorkers starts workers and passes them requests from outbox until context is done
+func (h *Handler) runOutboxWorkers(ctx context.Context) {
+	h.broadcasts.start(ctx)
+
+	go h.runEvery(ctx, h.config.OutboxInterval, h.drainOutbox)
+}
+
+// holdSignedNonces holds nonces of requests, that were signed before restart, but are not sent yet.
+// Network doesn't know them, so otherwise they would be given out to new requests
+func (h *Handler) holdSignedNonces() error {
+	reqs, err := h.st.LoadSignedRequests()
+	if err != nil {
+		return fmt.Errorf("can't load signed requests: %v", err)
+	}
+
+	for _, req := range reqs {
+		h.bc.Nonces().Hold(req.Transaction.From(), req.Transaction.Nonce())
+	}
+
+	return nil
+}
+
+// drainOutbox claims requests of outbox while queue of workers has place for them
+func (h *Handler) drainOutbox(ctx context.Context) {
+	lease := h.config.OutboxLease
+	if lease <= 0 {
+		lease = defaultOutboxLease
+	}
+
+	for ctx.Err() == nil && h.broadcasts.free() > 0 {
+		req, ok, err := h.st.ClaimSendRequest(lease)
+		if err != nil {
+			h.log.Errorw("can't claim send request", "error", err)
+			return
+		} else if !ok {
+			return
+		}
+
+		err = h.broadcasts.submit(func(ctx context.Context) {
+			h.processRequest(ctx, req)
+		})
+		if err != nil {
+			// Request is claimed again after lease
+			h.log.Warnw("broadcast queue is full", "request", req.RequestID)
+			return
+		}
+	}
+}
+
+// processRequest signs transaction of new request and sends signed one. Signed transaction is saved
+// before sending, so request is delivered at least once, but network gets only one transaction for it,
+// because retries send the same payload with the same nonce
+func (h *Handler) processRequest(ctx context.Context, req *storage.SendRequest) {
+	t := req.Transaction
+
+	if t.Status() == blockchain.QueuedStatus {
+		if err := h.bc.SignTransaction(ctx, t); err != nil {
+			h.retryRequest(req, err)
+			return
+		}
+
+		err := h.transit(t, blockchain.SignedStatus, req.RequestID, func(tx storage.Storage) error {
+			return tx.SaveSignedRequest(req.ID, t)
+		})
+		if err != nil {
+			h.bc.Nonces().Release(t.From(), t.Nonce())
+			h.log.Errorw("can't save signed transaction of request", "request", req.RequestID, "error", err)
+			return
+		}
+		// Nonce belongs to saved transaction from now, request is never signed again.
+		// It is held by nonce manager until network accepts transaction
+	}
+
+	txHash, err := h.bc.Rebroadcast(ctx, t)
+	if err != nil {
+		// Transaction, that was sent before restart, can be mined already, so network rejects it by nonce
+		if renewErr := h.bc.RenewTransaction(ctx, t); renewErr != nil {
+			h.retryRequest(req, err)
+			return
+		}
+		txHash = t.Hash()
+	}
+	t.SetHash(txHash)
+	h.bc.Nonces().Commit(t.From(), t.Nonce())
+
+	exists, err := h.st.TransactionExists(txHash)
+	if err != nil {
+		h.log.Errorw("can't check sent transaction of request", "request", req.RequestID, "hash", txHash, "error", err)
+		return
+	}
+
+	// Transaction and finished request are saved together, otherwise request is sent again after lease
+	// and transaction is saved then
+	err = h.transit(t, blockchain.BroadcastStatus, req.RequestID, func(tx storage.Storage) error {
+		if !exists {
+			t.FixateCreatedAt()
+			if err := saveTransaction(tx, t); err != nil {
+				return err
+			}
+		}
+
+		return tx.FinishSendRequest(req.ID, blockchain.BroadcastStatus, "")
+	})
+	if err != nil {
+		h.log.Errorw("can't finish send request", "request", req.RequestID, "error", err)
+		return
+	}
+	h.log.Infow("send request is sent", "request", req.RequestID, "hash", txHash)
+
+	// For getting information about block. Transaction is already in network, so it is saved
+	// anyway and its block is requested again while handling
+	if exists {
+		return
+	}
+	// Transaction is renewed before tracking, so confirmation check doesn't change it at the same time
+	if err = h.bc.RenewTransaction(ctx, t); err != nil {
+		h.log.Warnw("error while renewing transaction", "transaction", t, "error", err)
+	} else if t.IsMined() {
+		if err := h.saveMined(t); err != nil {
+			h.log.Errorw("can't update transaction block", "transaction", t, "error", err)
+		}
+	}
+	h.AddTransaction(t)
+}
+
+// retryRequest saves error of request, so it is tried again after lease, or drops request if attempts are exhausted.
+// Signed request is never dropped, because its nonce is taken, and later transactions of sender
+// are not mined until transaction with this nonce is
+func (h *Handler) retryRequest(req *storage.SendRequest, reqErr error) {
+	t := req.Transaction
+	exhausted := h.config.OutboxAttempts > 0 && req.Attempts >= h.config.OutboxAttempts
+	if !exhausted || t.Status() == blockchain.SignedStatus {
+		if exhausted {
+			h.log.Errorw("signed request can't be sent, it blocks nonce of sender and is retried", "request", req.RequestID,
+				"from", t.From(), "nonce", t.Nonce(), "attempt", req.Attempts, "error", reqErr)
+		} else {
+			h.log.Warnw("can't send request, it will be retried", "request", req.RequestID, "attempt", req.Attempts, "error", reqErr)
+		}
+		if err := h.st.SaveSendRequestError(req.ID, reqErr.Error()); err != nil {
+			h.log.Errorw("can't save error of send request", "request", req.RequestID, "error", err)
+		}
+		return
+	}
+
+	h.log.Errorw("send request is dropped", "request", req.RequestID, "status", t.Status(), "error", reqErr)
+	err := h.transit(t, blockchain.DroppedStatus, req.RequestID, func(tx storage.Storage) error {
+		return tx.FinishSendRequest(req.ID, blockchain.DroppedStatus, reqErr.Error())
+	})
+	if err != nil {
+		h.log.Errorw("can't drop send request", "request", req.RequestID, "error", err)
+	}
+}
@@ -0,0 +1,191 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/kainobor/eth-client/app/blockchain"
+)
+
+// OnReorg registers callback, that is called on each chain reorganization
+func (h *Handler) OnReorg(f func(*blockchain.ReorgEvent)) {
+	h.Lock()
+	h.reorgListeners = append(h.reorgListeners, f)
+	h.Unlock()
+}
+
+// handleHeaders saves headers of all new blocks and checks
+// by parent hashes that they continue saved chain
+func (h *Handler) handleHeaders(ctx context.Context) {
+	curBlock := h.CurBlockNum()
+	cur := curBlock.Int64()
+
+	last, ok, err := h.st.LoadLastHeaderNumber()
+	if err != nil {
+		h.log.Errorw("can't load last header", "error", err)
+		return
+	}
+
+	// Headers are saved from the moment of first launch and not deeper than history size
+	if !ok || cur-last > h.config.HeaderHistory {
+		last = cur - 1
+	}
+
+	for num := last + 1; num <= cur; num++ {
+		head, err := h.bc.GetHeader(ctx, *big.NewInt(num))
+		if err != nil {
+			h.log.Errorw("can't get header", "block", num, "error", err)
+			return
+		}
+
+		forkBlock, reorged, err := h.checkParent(ctx, head)
+		if err != nil {
+			h.log.Errorw("can't check chain", "block", num, "error", err)
+			return
+		}
+
+		// Blocks after fork are saved again from new chain
+		if reorged {
+			num = forkBlock
+			continue
+		}
+
+		if err := h.st.SaveHeader(head); err != nil {
+			h.log.Errorw("can't save header", "block", num, "error", err)
+			return
+		}
+	}
+
+	if err := h.st.PruneHeaders(cur - h.config.HeaderHistory); err != nil {
+		h.log.Errorw("can't prune headers", "error", err)
+	}
+}
+
+// checkParent compares parent hash of header with saved previous header
+// and handles reorganization if they are not equal
+func (h *Handler) checkParent(ctx context.Context, head *blockchain.Header) (int64, bool, error) {
+	headNum := head.Number()
+	num := headNum.Int64()
+
+	parent, ok, err := h.st.LoadHeader(num - 1)
+	if err != nil {
+		return 0, false, err
+	} else if !ok || parent.Hash() == head.ParentHash() {
+		return 0, false, nil
+	}
+
+	forkBlock, err := h.findForkBlock(ctx, num-1)
+	if err != nil {
+		return 0, false, fmt.Errorf("can't find fork block: %v", err)
+	}
+
+	if err := h.handleReorg(ctx, forkBlock); err != nil {
+		return 0, false, err
+	}
+
+	return forkBlock, true, nil
+}
+
+// findForkBlock goes back by saved headers and returns number of
+// the last block that is the same in saved and network chains
+func (h *Handler) findForkBlock(ctx context.Context, from int64) (int64, error) {
+	for num := from; ; num-- {
+		saved, ok, err := h.st.LoadHeader(num)
+		if err != nil {
+			return 0, err
+		} else if !ok {
+			// Fork is deeper than saved history
+			return num, nil
+		}
+
+		canonical, err := h.bc.GetHeader(ctx, *big.NewInt(num))
+		if err != nil {
+			return 0, err
+		}
+
+		if canonical.Hash() == saved.Hash() {
+			return num, nil
+		}
+	}
+}
+
+// handleReorg removes headers after fork, marks transactions from replaced blocks
+// as reorged, re-resolves their blocks and emits reorganization event
+func (h *Handler) handleReorg(ctx context.Context, forkBlock int64) error {
+	event := &blockchain.ReorgEvent{ForkBlock: forkBlock}
+
+	lastSaved, _, err := h.st.LoadLastHeaderNumber()
+	if err != nil {
+		return err
+	}
+	event.Depth = lastSaved - forkBlock
+
+	if oldHead, ok, err := h.st.LoadHeader(forkBlock + 1); err == nil && ok {
+		event.OldHead = oldHead.Hash()
+	}
+	if newHead, err := h.bc.GetHeader(ctx, *big.NewInt(forkBlock + 1)); err == nil {
+		event.NewHead = newHead.Hash()
+	}
+
+	if err := h.st.DeleteHeadersAfter(forkBlock); err != nil {
+		return err
+	}
+
+	txs, err := h.st.LoadTransactionsAfterBlock(forkBlock)
+	if err != nil {
+		return fmt.Errorf("can't load transactions from replaced blocks: %v", err)
+	}
+
+	for hash, t := range txs {
+		// Transaction from handling queue is used, so its state stays consistent
+		if queued, ok := h.getTransaction(hash); ok {
+			t = queued
+		}
+
+		if err := h.reincludeTransaction(ctx, t); err != nil {
+			h.log.Errorw("can't re-resolve transaction block", "transaction", t, "error", err)
+		}
+	}
+
+	// Deposits from new blocks must be found again
+	if lastScanned, ok, err := h.st.LoadLastScannedBlock(); err == nil && ok && lastScanned > forkBlock {
+		if err := h.st.SaveLastScannedBlock(forkBlock); err != nil {
+			h.log.Errorw("can't rewind scanned blocks", "error", err)
+		}
+	}
+
+	h.log.Warnw("chain reorganization", "depth", event.Depth, "forkBlock", event.ForkBlock, "oldHead", event.OldHead, "newHead", event.NewHead, "transactions", len(txs))
+
+	h.RLock()
+	listeners := h.reorgListeners
+	h.RUnlock()
+	for _, f := range listeners {
+		f(event)
+	}
+
+	return nil
+}
+
+// reincludeTransaction marks transaction as reorged and gets its new block from network.
+// Transaction that is not mined again stays in queue without block
+func (h *Handler) reincludeTransaction(ctx context.Context, t *blockchain.Transaction) error {
+	// Block is restored, if reorganization is not saved, so transaction in memory stays the same as in DB
+	block, confirmations := t.Inclusion()
+	t.ResetBlock()
+	if err := h.transit(t, blockchain.ReorgedStatus, "", saveBlock(t)); err != nil {
+		t.SetInclusion(block, confirmations)
+		return err
+	}
+	h.AddTransaction(t)
+
+	if err := h.bc.RenewTransaction(ctx, t); err != nil && err != blockchain.ErrTransactionNotFound {
+		return err
+	}
+
+	if t.IsMined() {
+		return h.saveMined(t)
+	}
+
+	return nil
+}
@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/kainobor/eth-client/app/blockchain"
+	"github.com/kainobor/eth-client/app/storage"
+)
+
+// ErrNotReplaceable is returned when transaction can't be replaced anymore
+var ErrNotReplaceable = errors.New("transaction is not pending")
+
+// SpeedUp sends the same transfer as pending transaction with its nonce and bumped fees
+func (h *Handler) SpeedUp(ctx context.Context, hash string) (*blockchain.Transaction, error) {
+	prev, err := h.loadReplaceable(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return h.replace(ctx, prev, blockchain.NewReplacement(prev))
+}
+
+// Cancel sends zero-value transfer to sender itself with nonce of pending transaction and bumped fees
+func (h *Handler) Cancel(ctx context.Context, hash string) (*blockchain.Transaction, error) {
+	prev, err := h.loadReplaceable(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return h.replace(ctx, prev, blockchain.NewCancellation(prev))
+}
+
+// loadReplaceable returns the latest transaction of replacement chain, that contains transaction
+// with hash, and checks that it is not mined yet
+func (h *Handler) loadReplaceable(hash string) (*blockchain.Transaction, error) {
+	prev, ok, err := h.st.LoadLastInChain(hash)
+	if err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, fmt.Errorf("transaction `%s` was not sent by application", hash)
+	}
+
+	if !blockchain.IsPending(prev.Status()) {
+		return nil, ErrNotReplaceable
+	}
+
+	if tracked, ok := h.getTransaction(prev.Hash()); ok && tracked.IsMined() {
+		return nil, ErrNotReplaceable
+	}
+
+	return prev, nil
+}
+
+// replace sends replacement of previous transaction and starts its tracking. Signed replacement is saved
+// before sending, so transaction, that is in network, is always tracked. Replacement, that is not sent,
+// is tracked as dropped one and is sent again from saved payload
+func (h *Handler) replace(ctx context.Context, prev, t *blockchain.Transaction) (*blockchain.Transaction, error) {
+	if err := h.bc.SignReplacement(ctx, t, prev); err != nil {
+		return nil, fmt.Errorf("can't sign replacement: %v", err)
+	}
+	t.SetReplaced(prev)
+	t.FixateCreatedAt()
+
+	err := h.transit(t, blockchain.SignedStatus, "", func(tx storage.Storage) error {
+		return saveTransaction(tx, t)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("can't save replacement: %v", err)
+	}
+
+	if _, err := h.bc.Rebroadcast(ctx, t); err != nil {
+		if dropErr := h.transit(t, blockchain.DroppedStatus, "", saveStatus(t)); dropErr != nil {
+			h.log.Errorw("can't mark replacement as dropped", "hash", t.Hash(), "error", dropErr)
+		} else {
+			h.AddTransaction(t)
+		}
+		return nil, fmt.Errorf("can't send replacement `%s`: %v", t.Hash(), err)
+	}
+
+	if err := h.transit(t, blockchain.BroadcastStatus, "", saveStatus(t)); err != nil {
+		return nil, fmt.Errorf("replacement `%s` is sent, but its status is not saved: %v", t.Hash(), err)
+	}
+	h.AddTransaction(t)
+	h.log.Infow("transaction replaced", "replaced", prev.Hash(), "replacement", t.Hash(), "origin", t.Origin())
+
+	return t, nil
+}
+
+// resolveReplacements stops tracking of transactions, that were replaced by mined one.
+// Their statuses and history are saved together
+func (h *Handler) resolveReplacements(t *blockchain.Transaction) {
+	var replaced []string
+	err := h.st.WithTx(func(tx storage.Storage) error {
+		prevStatuses, err := tx.ResolveReplacements(t.Hash())
+		if err != nil {
+			return err
+		}
+
+		replaced = replaced[:0]
+		for hash, prevStatus := range prevStatuses {
+			tr, err := blockchain.NewTransition(hash, prevStatus, blockchain.ReplacedStatus)
+			if err != nil {
+				return err
+			}
+			if err := tx.SaveTransition(tr); err != nil {
+				return err
+			}
+			replaced = append(replaced, hash)
+		}
+
+		return nil
+	})
+	if err != nil {
+		h.log.Errorw("can't resolve replacements", "transaction", t, "error", err)
+		return
+	}
+
+	for _, hash := range replaced {
+		if tracked, ok := h.getTransaction(hash); ok {
+			tracked.SetStatus(blockchain.ReplacedStatus)
+		}
+		h.delTransaction(hash)
+	}
+}
@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/kainobor/eth-client/app/blockchain"
+	"github.com/kainobor/eth-client/app/helper"
+	"github.com/kainobor/eth-client/app/storage"
+)
+
+// watchBlocks checks chain and scans blocks on each new block and on ticker if new blocks are not pushed
+func (h *Handler) watchBlocks(ctx context.Context) {
+	tcr := time.NewTicker(h.config.ScanInterval)
+	defer tcr.Stop()
+
+	for {
+		select {
+		case <-tcr.C:
+		case <-h.newBlocks:
+		case <-ctx.Done():
+			return
+		}
+
+		h.handleHeaders(ctx)
+		h.handleDeposits(ctx)
+	}
+}
+
+// handleDeposits walks all blocks after last scanned one
+// and records incoming transactions to watched addresses
+func (h *Handler) handleDeposits(ctx context.Context) {
+	curBlock := h.CurBlockNum()
+	lastBlock, ok, err := h.st.LoadLastScannedBlock()
+	if err != nil {
+		h.log.Errorw("can't load last scanned block", "error", err)
+		return
+	}
+
+	// Scanning starts from the moment of first launch
+	if !ok {
+		if err := h.st.SaveLastScannedBlock(curBlock.Int64()); err != nil {
+			h.log.Errorw("can't save last scanned block", "error", err)
+		}
+		return
+	}
+
+	if lastBlock >= curBlock.Int64() {
+		return
+	}
+
+	watched, err := h.st.LoadWatchedAddresses()
+	if err != nil {
+		h.log.Errorw("can't load watched addresses", "error", err)
+		return
+	}
+
+	lastToScan := curBlock.Int64()
+	if h.config.ScanBatchSize > 0 && lastToScan-lastBlock > h.config.ScanBatchSize {
+		lastToScan = lastBlock + h.config.ScanBatchSize
+	}
+
+	for num := lastBlock + 1; num <= lastToScan; num++ {
+		if err := h.scanBlock(ctx, num, watched); err != nil {
+			h.log.Errorw("can't scan block", "block", num, "error", err)
+			return
+		}
+
+		if err := h.st.SaveLastScannedBlock(num); err != nil {
+			h.log.Errorw("can't save last scanned block", "block", num, "error", err)
+			return
+		}
+	}
+}
+
+// scanBlock saves deposits from block and adds them to confirmation tracking
+func (h *Handler) scanBlock(ctx context.Context, num int64, watched map[string]bool) error {
+	_, txs, err := h.bc.GetBlockTransactions(ctx, *big.NewInt(num))
+	if err != nil {
+		return err
+	}
+
+	for _, t := range txs {
+		if !h.isDeposit(t, watched) || h.hasTransaction(t.Hash()) {
+			continue
+		}
+
+		exists, err := h.st.TransactionExists(t.Hash())
+		if err != nil {
+			return err
+		} else if exists {
+			continue
+		}
+
+		t.FixateCreatedAt()
+		err = h.transit(t, blockchain.MinedStatus, "", func(tx storage.Storage) error {
+			return tx.SaveEntryTransaction(t)
+		})
+		if err != nil {
+			return fmt.Errorf("can't save deposit: %v", err)
+		}
+		h.AddTransaction(t)
+
+		amount := t.Amount()
+		h.log.Infow("deposit detected", "hash", t.Hash(), "to", t.Recipient(), "amount", helper.BigToHex(amount), "token", t.Token())
+	}
+
+	return nil
+}
+
+// isDeposit checks that transaction transfers ETH or known tokens to watched address
+// and marks token transfers
+func (h *Handler) isDeposit(t *blockchain.Transaction, watched map[string]bool) bool {
+	value := t.Value()
+	if watched[strings.ToLower(t.To())] && value.BitLen() > 0 {
+		return true
+	}
+
+	token, ok := h.bc.Tokens().ByAddress(t.To())
+	if !ok {
+		return false
+	}
+
+	to, amount, ok := blockchain.DecodeTransfer(t.Data())
+	if !ok || !watched[to] {
+		return false
+	}
+
+	t.SetTokenTransfer(token.Address(), to, *amount)
+
+	return true
+}
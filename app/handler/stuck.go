@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"context"
+	"time"
+
+	"github.com/kainobor/eth-client/app/blockchain"
+)
+
+const (
+	// StuckAlertPolicy only reports stuck transactions
+	StuckAlertPolicy = "alert"
+	// StuckBumpPolicy replaces stuck transactions with bumped fees
+	StuckBumpPolicy = "bump"
+)
+
+// handleStuck finds sent transactions, that are not mined too long or dropped out of mempool.
+// Stuck ones are reported or sped up by policy, dropped ones are sent again
+func (h *Handler) handleStuck(ctx context.Context) {
+	curBlock := h.CurBlockNum()
+	pending := h.copyTransactions()
+
+	// Transactions that are not pending anymore are forgotten
+	for hash := range h.firstSeen {
+		if t, ok := pending[hash]; !ok || t.IsMined() {
+			delete(h.firstSeen, hash)
+			delete(h.alerted, hash)
+		}
+	}
+
+	for hash, t := range pending {
+		if t.IsMined() {
+			continue
+		}
+
+		if _, ok := h.firstSeen[hash]; !ok {
+			h.firstSeen[hash] = curBlock.Int64()
+		}
+
+		// Only the latest transaction of replacement chain sent by application is checked
+		last, ok, err := h.st.LoadLastInChain(hash)
+		if err != nil {
+			h.log.Errorw("can't load sent transaction", "hash", hash, "error", err)
+			continue
+		} else if !ok || last.Hash() != hash {
+			continue
+		}
+
+		// Tracked transaction is not renewed here, its block is saved only by confirmation check
+		probe := new(blockchain.Transaction)
+		probe.SetHash(hash)
+		err = h.bc.RenewTransaction(ctx, probe)
+		if err == blockchain.ErrTransactionNotFound {
+			h.rebroadcast(ctx, t, last)
+			continue
+		} else if err != nil {
+			h.log.Errorw("can't renew pending transaction", "hash", hash, "error", err)
+			continue
+		} else if probe.IsMined() {
+			continue
+		}
+
+		// Dropped transaction is back in mempool of node
+		if t.Status() == blockchain.DroppedStatus {
+			if err := h.transit(t, blockchain.BroadcastStatus, "", saveStatus(t)); err != nil {
+				h.log.Errorw("can't mark transaction as broadcast", "hash", hash, "error", err)
+			}
+		}
+
+		if h.isStuck(t, curBlock.Int64()-h.firstSeen[hash]) {
+			h.handleStuckTransaction(ctx, last)
+		}
+	}
+}
+
+// isStuck checks that transaction is not mined after configured amount of blocks or time
+func (h *Handler) isStuck(t *blockchain.Transaction, blocksPassed int64) bool {
+	return (h.config.StuckBlocks > 0 && blocksPassed >= h.config.StuckBlocks) ||
+		(h.config.StuckTimeout > 0 && time.Since(t.CreatedAt()) >= h.config.StuckTimeout)
+}
+
+// handleStuckTransaction speeds up stuck transaction if policy allows it and fee bumps are not exhausted,
+// otherwise reports it once
+func (h *Handler) handleStuckTransaction(ctx context.Context, t *blockchain.Transaction) {
+	if h.config.StuckPolicy == StuckBumpPolicy {
+		bumps, err := h.st.CountReplacements(t.Hash())
+		if err != nil {
+			h.log.Errorw("can't count fee bumps", "hash", t.Hash(), "error", err)
+			return
+		}
+
+		if bumps < h.config.MaxFeeBumps {
+			replacement, err := h.SpeedUp(ctx, t.Hash())
+			if err == nil {
+				h.log.Warnw("stuck transaction is sped up", "hash", t.Hash(), "replacement", replacement.Hash(), "bumps", bumps+1)
+				return
+			}
+
+			// Fee cap reached or node rejected replacement, so transaction is only reported
+			h.log.Errorw("can't speed up stuck transaction", "hash", t.Hash(), "error", err)
+		}
+	}
+
+	if h.alerted[t.Hash()] {
+		return
+	}
+	h.alerted[t.Hash()] = true
+
+	h.log.Warnw("transaction is stuck", "hash", t.Hash(), "from", t.From(), "nonce", t.Nonce())
+}
+
+// rebroadcast marks tracked transaction as dropped and sends it again from saved signed payload
+func (h *Handler) rebroadcast(ctx context.Context, t, sent *blockchain.Transaction) {
+	if t.Status() != blockchain.DroppedStatus {
+		if err := h.transit(t, blockchain.DroppedStatus, "", saveStatus(t)); err != nil {
+			h.log.Errorw("can't mark transaction as dropped", "hash", t.Hash(), "error", err)
+			return
+		}
+	}
+
+	if _, err := h.bc.Rebroadcast(ctx, sent); err != nil {
+		h.log.Errorw("can't rebroadcast dropped transaction", "hash", t.Hash(), "error", err)
+		return
+	}
+
+	if err := h.transit(t, blockchain.BroadcastStatus, "", saveStatus(t)); err != nil {
+		h.log.Errorw("can't mark transaction as broadcast", "hash", t.Hash(), "error", err)
+		return
+	}
+
+	h.log.Warnw("dropped transaction is rebroadcast", "hash", t.Hash())
+}
@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrQueueFull is returned when there is no place for new job in queue of workers
+var ErrQueueFull = errors.New("queue is full, try later")
+
+type (
+	// workerPool runs jobs in fixed amount of goroutines, jobs are waiting in queue of limited size
+	workerPool struct {
+		workers int
+		jobs    chan func(context.Context)
+	}
+)
+
+// newWorkerPool is constructor, at least one worker and place in queue are used
+func newWorkerPool(workers, queueSize int) *workerPool {
+	if workers <= 0 {
+		workers = 1
+	}
+	if queueSize <= 0 {
+		queueSize = 1
+	}
+
+	return &workerPool{workers: workers, jobs: make(chan func(context.Context), queueSize)}
+}
+
+// start workers, that run jobs until context is done
+func (p *workerPool) start(ctx context.Context) {
+	for i := 0; i < p.workers; i++ {
+		go p.work(ctx)
+	}
+}
+
+func (p *workerPool) work(ctx context.Context) {
+	for {
+		select {
+		case job := <-p.jobs:
+			job(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// submit puts job to queue without waiting, ErrQueueFull is returned if queue has no place
+func (p *workerPool) submit(job func(context.Context)) error {
+	select {
+	case p.jobs <- job:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// free returns amount of places in queue
+func (p *workerPool) free() int {
+	return cap(p.jobs) - len(p.jobs)
+}
@@ -1,6 +1,7 @@
 package helper
 
 import (
+	"encoding/hex"
 	"fmt"
 	"math/big"
 	"strings"
@@ -28,6 +29,28 @@ func HexToBig(hex string) (*big.Int, bool) {
 	return bigVal.SetString(hex, 16)
 }
 
+// HexToUint64 converts hex string to uint64
+func HexToUint64(hex string) (uint64, bool) {
+	bigVal, ok := HexToBig(hex)
+	if !ok || !bigVal.IsUint64() {
+		return 0, false
+	}
+
+	return bigVal.Uint64(), true
+}
+
+// BytesToHex converts bytes to hexadecimal representation
+func BytesToHex(b []byte) string {
+	return "0x" + hex.EncodeToString(b)
+}
+
+// HexToBytes converts hex string to bytes
+func HexToBytes(s string) ([]byte, bool) {
+	b, err := hex.DecodeString(TrimHexPrefix(s))
+
+	return b, err == nil
+}
+
 // IsHexAddress validates that string is valid ETH address
 func IsHexAddress(s string) bool {
 	s = TrimHexPrefix(s)
@@ -1,6 +1,8 @@
 package server
 
 import (
+	"context"
+	"expvar"
 	"fmt"
 	"net/http"
 
@@ -12,8 +14,14 @@ import (
 )
 
 const (
-	sendEthRoute = "/SendEth"
-	getLastRoute = "/GetLast"
+	sendEthRoute   = "/SendEth"
+	sendTokenRoute = "/SendToken"
+	getLastRoute   = "/GetLast"
+	watchRoute     = "/Watch"
+	speedUpRoute   = "/SpeedUp"
+	cancelRoute    = "/Cancel"
+	historyRoute   = "/History"
+	metricsRoute   = "/debug/vars"
 )
 
 type (
@@ -34,12 +42,30 @@ func New(c *config.ServerConfig, bc *blockchain.Client, l *logger.Logger) *Serve
 // RegisterRoutes registers all available routes in server router
 func (srv *Server) RegisterRoutes(ctrl *controller.Controller) {
 	srv.router.HandleFunc(sendEthRoute, ctrl.SendEth).Methods("GET")
+	srv.router.HandleFunc(sendTokenRoute, ctrl.SendToken).Methods("GET")
 	srv.router.HandleFunc(getLastRoute, ctrl.GetLast).Methods("GET")
+	srv.router.HandleFunc(watchRoute, ctrl.Watch).Methods("GET")
+	srv.router.HandleFunc(speedUpRoute, ctrl.SpeedUp).Methods("GET")
+	srv.router.HandleFunc(cancelRoute, ctrl.Cancel).Methods("GET")
+	srv.router.HandleFunc(historyRoute, ctrl.History).Methods("GET")
+	srv.router.Handle(metricsRoute, expvar.Handler()).Methods("GET")
 }
 
-// Start listening of TCP-connections
-func (srv *Server) Start() error {
-	err := http.ListenAndServe(fmt.Sprintf(":%d", srv.config.Port), srv.router)
+// Start listening of TCP-connections until context is done. Contexts of requests
+// are cancelled when server is shutting down or client is gone
+func (srv *Server) Start(ctx context.Context) error {
+	httpSrv := &http.Server{Addr: fmt.Sprintf(":%d", srv.config.Port), Handler: srv.router}
 
-	return fmt.Errorf("starting was ended with error: %v", err)
+	go func() {
+		<-ctx.Done()
+		if err := httpSrv.Shutdown(context.Background()); err != nil {
+			srv.log.Errorw("error while shutting down server", "error", err)
+		}
+	}()
+
+	if err := httpSrv.ListenAndServe(); err != http.ErrServerClosed {
+		return fmt.Errorf("starting was ended with error: %v", err)
+	}
+
+	return nil
 }
@@ -0,0 +1,37 @@
+package storage
+
+import (
+	"fmt"
+
+	"github.com/kainobor/eth-client/app/blockchain"
+)
+
+// SaveTransition saves change of transaction status to history
+func (st *sqlStorage) SaveTransition(tr *blockchain.Transition) error {
+	_, err := st.db.Exec(InsertTransitionSQL, nullString(tr.RequestID), nullString(tr.Hash), nullString(tr.FromStatus), tr.ToStatus, tr.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("error while saving transition: %v", err)
+	}
+
+	return nil
+}
+
+// LoadHistory returns all changes of status of transaction with hash or of send request with ID
+func (st *sqlStorage) LoadHistory(id string) ([]*blockchain.Transition, error) {
+	rows, err := st.db.Query(SelectHistorySQL, id)
+	if err != nil {
+		return nil, fmt.Errorf("error while selecting history: %v", err)
+	}
+	defer rows.Close()
+
+	var history []*blockchain.Transition
+	for rows.Next() {
+		tr := new(blockchain.Transition)
+		if err := rows.Scan(&tr.RequestID, &tr.Hash, &tr.FromStatus, &tr.ToStatus, &tr.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error while scanning transition: %v", err)
+		}
+		history = append(history, tr)
+	}
+
+	return history, rows.Err()
+}
@@ -0,0 +1,943 @@
+package memory
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kainobor/eth-client/app/blockchain"
+	"github.com/kainobor/eth-client/app/helper"
+	"github.com/kainobor/eth-client/app/storage"
+)
+
+type (
+	// Storage keeps all data in memory, it behaves like database storage and is used in tests
+	Storage struct {
+		*data
+		mu   *sync.Mutex
+		inTx bool // Storage of transaction works under lock, that is taken by WithTx
+	}
+
+	// data is content of storage, that is shared by storage and its transactions
+	data struct {
+		balances      map[string]big.Int
+		tokenBalances map[string]map[string]big.Int // Balances by token and address
+		watched       map[string]bool
+		entries       []*entry
+		withdraws     []*withdraw
+		headers       map[int64]*blockchain.Header
+		lastScanned   *int64
+		outbox        []*outboxRow
+		history       []*historyRow
+		lastID        int64
+	}
+
+	entry struct {
+		id            int64
+		hash          string
+		blockHash     string
+		blockNumber   int64
+		from          string
+		to            string
+		confirmations int64
+		amount        big.Int
+		token         string
+		status        string
+		showed        bool
+		receipt       *blockchain.Receipt
+		createdAt     time.Time
+	}
+
+	withdraw struct {
+		id           int64
+		hash         string
+		from         string
+		to           string
+		amount       big.Int
+		token        string
+		gas          int64
+		gasPrice     string
+		maxFee       string
+		maxTip       string
+		nonce        int64
+		data         string
+		raw          string
+		replaces     string
+		originalHash string
+	}
+
+	outboxRow struct {
+		req         storage.SendRequest
+		lockedUntil time.Time
+		from        string
+		to          string
+		amount      big.Int
+		token       string
+		data        string
+		hash        string
+		nonce       int64
+		gas         int64
+		gasPrice    string
+		maxFee      string
+		maxTip      string
+		raw         string
+	}
+
+	historyRow struct {
+		id int64
+		tr blockchain.Transition
+	}
+)
+
+var _ storage.Storage = (*Storage)(nil)
+
+// New storage in memory
+func New() *Storage {
+	return &Storage{
+		data: &data{
+			balances:      make(map[string]big.Int),
+			tokenBalances: make(map[string]map[string]big.Int),
+			watched:       make(map[string]bool),
+			headers:       make(map[int64]*blockchain.Header),
+		},
+		mu: new(sync.Mutex),
+	}
+}
+
+// Connect does nothing, storage is always ready
+func (st *Storage) Connect() error {
+	return nil
+}
+
+// Close does nothing, data is kept until storage is collected
+func (st *Storage) Close() error {
+	return nil
+}
+
+// WithTx runs fn with storage of transaction. Other calls wait until transaction is finished,
+// and all changes of fn are reverted if it returns error
+func (st *Storage) WithTx(fn func(tx storage.Storage) error) error {
+	st.Lock()
+	defer st.Unlock()
+
+	snapshot := st.data.copy()
+	if err := fn(&Storage{data: st.data, mu: st.mu, inTx: true}); err != nil {
+		*st.data = *snapshot
+		return err
+	}
+
+	return nil
+}
+
+// Lock locks data of storage, storage of transaction is already locked
+func (st *Storage) Lock() {
+	if !st.inTx {
+		st.mu.Lock()
+	}
+}
+
+// Unlock unlocks data of storage
+func (st *Storage) Unlock() {
+	if !st.inTx {
+		st.mu.Unlock()
+	}
+}
+
+// UpsertBalance inserts or updates balance by some address
+func (st *Storage) UpsertBalance(addr string, balance *big.Int) error {
+	st.Lock()
+	st.balances[strings.ToLower(addr)] = copyBig(*balance)
+	st.Unlock()
+
+	return nil
+}
+
+// UpsertTokenBalance inserts or updates balance of token by some address
+func (st *Storage) UpsertTokenBalance(addr, token string, balance *big.Int) error {
+	st.Lock()
+	defer st.Unlock()
+
+	token = strings.ToLower(token)
+	if st.tokenBalances[token] == nil {
+		st.tokenBalances[token] = make(map[string]big.Int)
+	}
+	st.tokenBalances[token][strings.ToLower(addr)] = copyBig(*balance)
+
+	return nil
+}
+
+// LoadAllBalances returns map with all balances
+func (st *Storage) LoadAllBalances() (map[string]*big.Int, error) {
+	st.Lock()
+	defer st.Unlock()
+
+	return st.loadBalances(st.balances), nil
+}
+
+// LoadTokenBalances returns map with balances of token for all addresses
+func (st *Storage) LoadTokenBalances(token string) (map[string]*big.Int, error) {
+	st.Lock()
+	defer st.Unlock()
+
+	return st.loadBalances(st.tokenBalances[strings.ToLower(token)]), nil
+}
+
+// loadBalances returns balances of all addresses used by application, unknown balances are zero
+func (st *Storage) loadBalances(balances map[string]big.Int) map[string]*big.Int {
+	addrs := make(map[string]bool)
+	for addr := range st.balances {
+		addrs[addr] = true
+	}
+	for _, e := range st.entries {
+		addrs[e.from] = true
+		addrs[e.to] = true
+	}
+
+	balMap := make(map[string]*big.Int)
+	for addr := range addrs {
+		// Address without saved balance has zero balance
+		bal := balances[addr]
+		balMap[addr] = new(big.Int).Set(&bal)
+	}
+
+	return balMap
+}
+
+// SaveEntryTransaction inserts entry transaction and renews transaction ID
+func (st *Storage) SaveEntryTransaction(t *blockchain.Transaction) error {
+	st.Lock()
+	defer st.Unlock()
+
+	blockNum := t.BlockNumber()
+	st.lastID++
+	st.entries = append(st.entries, &entry{
+		id:          st.lastID,
+		hash:        t.Hash(),
+		blockHash:   t.BlockHash(),
+		blockNumber: (&blockNum).Int64(),
+		from:        t.From(),
+		to:          t.Recipient(),
+		amount:      copyBig(t.Amount()),
+		token:       t.Token(),
+		status:      t.Status(),
+		createdAt:   t.CreatedAt(),
+	})
+	t.SetID(st.lastID)
+
+	return nil
+}
+
+// SaveWithdrawTransaction saves transaction as withdraw with gas values for cost accounting
+func (st *Storage) SaveWithdrawTransaction(t *blockchain.Transaction) error {
+	st.Lock()
+	defer st.Unlock()
+
+	w := &withdraw{
+		hash:     t.Hash(),
+		from:     t.From(),
+		to:       t.Recipient(),
+		amount:   copyBig(t.Amount()),
+		token:    t.Token(),
+		gas:      int64(t.Gas()),
+		gasPrice: helper.BigToHex(t.GasPrice()),
+		maxFee:   helper.BigToHex(t.MaxFeePerGas()),
+		maxTip:   helper.BigToHex(t.MaxPriorityFeePerGas()),
+		nonce:    int64(t.Nonce()),
+		data:     helper.BytesToHex(t.Data()),
+		raw:      helper.BytesToHex(t.Raw()),
+		replaces: t.Replaces(),
+	}
+	// Only replacements refer to the first transaction of chain
+	if w.replaces != "" {
+		w.originalHash = t.Origin()
+	}
+
+	st.lastID++
+	w.id = st.lastID
+	st.withdraws = append(st.withdraws, w)
+
+	return nil
+}
+
+// TransactionExists checks that entry transaction with hash is saved
+func (st *Storage) TransactionExists(hash string) (bool, error) {
+	st.Lock()
+	defer st.Unlock()
+
+	return st.entryByHash(hash) != nil, nil
+}
+
+// UpdateConfirmations updates confirmations amount by ID
+func (st *Storage) UpdateConfirmations(id, confirmations int64) error {
+	return st.updateEntry(id, func(e *entry) {
+		e.confirmations = confirmations
+	})
+}
+
+// UpdateTransactionStatus updates status by ID
+func (st *Storage) UpdateTransactionStatus(id int64, status string) error {
+	return st.updateEntry(id, func(e *entry) {
+		e.status = status
+	})
+}
+
+// UpdateTransactionBlock saves block of transaction with reset confirmations and status
+func (st *Storage) UpdateTransactionBlock(t *blockchain.Transaction) error {
+	blockNum := t.BlockNumber()
+
+	return st.updateEntry(t.ID(), func(e *entry) {
+		e.blockHash = t.BlockHash()
+		e.blockNumber = (&blockNum).Int64()
+		e.confirmations = 0
+		e.status = t.Status()
+	})
+}
+
+// SaveReceipt saves receipt of transaction by ID
+func (st *Storage) SaveReceipt(id int64, r *blockchain.Receipt) error {
+	return st.updateEntry(id, func(e *entry) {
+		e.receipt = r
+	})
+}
+
+// TransactionsShowed updates all transactions as showed
+func (st *Storage) TransactionsShowed(txs map[string]*blockchain.Transaction) error {
+	st.Lock()
+	defer st.Unlock()
+
+	for _, t := range txs {
+		for _, e := range st.entries {
+			if e.id == t.ID() {
+				e.showed = true
+			}
+		}
+	}
+
+	return nil
+}
+
+// LoadActiveTransactions returns all transactions, that are sent, but not finished
+func (st *Storage) LoadActiveTransactions() (map[string]*blockchain.Transaction, error) {
+	return st.loadTransactions(func(e *entry) bool {
+		for _, status := range blockchain.ActiveStatuses {
+			if e.status == status {
+				return true
+			}
+		}
+
+		return false
+	})
+}
+
+// LoadLastTransactions returns all not shown transactions
+// with amount of confirmations less than some value
+func (st *Storage) LoadLastTransactions(lastConfirmations int64) (map[string]*blockchain.Transaction, error) {
+	return st.loadTransactions(func(e *entry) bool {
+		return (!e.showed || e.confirmations < lastConfirmations) && e.status != blockchain.ReplacedStatus
+	})
+}
+
+// LoadTransactionsAfterBlock returns all transactions included in blocks after some number
+func (st *Storage) LoadTransactionsAfterBlock(number int64) (map[string]*blockchain.Transaction, error) {
+	return st.loadTransactions(func(e *entry) bool {
+		return e.blockNumber > number
+	})
+}
+
+// LoadLastInChain returns the latest sent transaction of replacement chain, that contains transaction with hash
+func (st *Storage) LoadLastInChain(hash string) (*blockchain.Transaction, bool, error) {
+	st.Lock()
+	defer st.Unlock()
+
+	origin, ok := st.chainOrigin(hash)
+	if !ok {
+		return nil, false, nil
+	}
+
+	for i := len(st.withdraws) - 1; i >= 0; i-- {
+		w := st.withdraws[i]
+		e := st.entryByHash(w.hash)
+		if w.origin() != origin || e == nil {
+			continue
+		}
+
+		t := new(blockchain.Transaction)
+		err := t.FillFromWithdraw(&blockchain.DBWithdraw{
+			Hash:     w.hash,
+			From:     w.from,
+			To:       w.to,
+			Amount:   new(big.Int).Set(&w.amount),
+			Token:    w.token,
+			Nonce:    w.nonce,
+			Gas:      w.gas,
+			GasPrice: w.gasPrice,
+			MaxFee:   w.maxFee,
+			MaxTip:   w.maxTip,
+			Data:     w.data,
+			Raw:      w.raw,
+			Origin:   w.origin(),
+			Status:   e.status,
+		})
+		if err != nil {
+			return nil, false, err
+		}
+
+		return t, true, nil
+	}
+
+	return nil, false, nil
+}
+
+// ResolveReplacements marks other unmined transactions of replacement chain of mined transaction
+// as replaced and returns their previous statuses by hashes
+func (st *Storage) ResolveReplacements(minedHash string) (map[string]string, error) {
+	st.Lock()
+	defer st.Unlock()
+
+	replaced := make(map[string]string)
+	origin, ok := st.chainOrigin(minedHash)
+	if !ok {
+		return replaced, nil
+	}
+
+	for _, w := range st.withdraws {
+		e := st.entryByHash(w.hash)
+		if w.origin() != origin || w.hash == minedHash || e == nil || !blockchain.IsPending(e.status) {
+			continue
+		}
+
+		replaced[e.hash] = e.status
+		e.status = blockchain.ReplacedStatus
+	}
+
+	return replaced, nil
+}
+
+// CountReplacements returns amount of replacements in chain, that contains transaction with hash
+func (st *Storage) CountReplacements(hash string) (int, error) {
+	st.Lock()
+	defer st.Unlock()
+
+	origin, ok := st.chainOrigin(hash)
+	if !ok {
+		return 0, nil
+	}
+
+	var count int
+	for _, w := range st.withdraws {
+		if w.originalHash == origin {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// AddWatchedAddress adds address to watch-list of incoming transactions
+func (st *Storage) AddWatchedAddress(addr string) error {
+	st.Lock()
+	st.watched[strings.ToLower(addr)] = true
+	st.Unlock()
+
+	return nil
+}
+
+// LoadWatchedAddresses returns set of addresses with known balances or from watch-list
+func (st *Storage) LoadWatchedAddresses() (map[string]bool, error) {
+	st.Lock()
+	defer st.Unlock()
+
+	addrs := make(map[string]bool)
+	for addr := range st.balances {
+		addrs[strings.ToLower(helper.TrimHexPrefix(addr))] = true
+	}
+	for addr := range st.watched {
+		addrs[strings.ToLower(helper.TrimHexPrefix(addr))] = true
+	}
+
+	return addrs, nil
+}
+
+// LoadLastScannedBlock returns number of last block that was checked for deposits,
+// false is returned if scanning was never done
+func (st *Storage) LoadLastScannedBlock() (int64, bool, error) {
+	st.Lock()
+	defer st.Unlock()
+
+	if st.lastScanned == nil {
+		return 0, false, nil
+	}
+
+	return *st.lastScanned, true, nil
+}
+
+// SaveLastScannedBlock saves number of last block that was checked for deposits
+func (st *Storage) SaveLastScannedBlock(blockNumber int64) error {
+	st.Lock()
+	st.lastScanned = &blockNumber
+	st.Unlock()
+
+	return nil
+}
+
+// SaveHeader saves header of block, header with the same number is replaced
+func (st *Storage) SaveHeader(h *blockchain.Header) error {
+	number := h.Number()
+
+	st.Lock()
+	st.headers[number.Int64()] = blockchain.NewHeader(number, h.Hash(), h.ParentHash())
+	st.Unlock()
+
+	return nil
+}
+
+// LoadHeader returns saved header of block with some number, false is returned if it is not saved
+func (st *Storage) LoadHeader(number int64) (*blockchain.Header, bool, error) {
+	st.Lock()
+	defer st.Unlock()
+
+	h, ok := st.headers[number]
+
+	return h, ok, nil
+}
+
+// LoadLastHeaderNumber returns number of the most recent saved header, false is returned if there are no headers
+func (st *Storage) LoadLastHeaderNumber() (int64, bool, error) {
+	st.Lock()
+	defer st.Unlock()
+
+	var last int64
+	var ok bool
+	for number := range st.headers {
+		if !ok || number > last {
+			last, ok = number, true
+		}
+	}
+
+	return last, ok, nil
+}
+
+// DeleteHeadersAfter deletes headers of blocks after some number
+func (st *Storage) DeleteHeadersAfter(number int64) error {
+	return st.deleteHeaders(func(n int64) bool { return n > number })
+}
+
+// PruneHeaders deletes headers of blocks before some number
+func (st *Storage) PruneHeaders(number int64) error {
+	return st.deleteHeaders(func(n int64) bool { return n < number })
+}
+
+func (st *Storage) deleteHeaders(match func(int64) bool) error {
+	st.Lock()
+	defer st.Unlock()
+
+	for number := range st.headers {
+		if match(number) {
+			delete(st.headers, number)
+		}
+	}
+
+	return nil
+}
+
+// AddSendRequest saves request with transaction, that is not signed yet, to outbox.
+// False is returned if client already has request with the same idempotency key
+func (st *Storage) AddSendRequest(req *storage.SendRequest) (bool, error) {
+	st.Lock()
+	defer st.Unlock()
+
+	for _, row := range st.outbox {
+		if row.req.RequestID == req.RequestID {
+			return false, fmt.Errorf("error while adding send request: request `%s` already exists", req.RequestID)
+		}
+		if req.IdempotencyKey != "" && row.req.ClientID == req.ClientID && row.req.IdempotencyKey == req.IdempotencyKey {
+			return false, nil
+		}
+	}
+
+	t := req.Transaction
+	st.lastID++
+	row := &outboxRow{
+		req:    *req,
+		from:   t.From(),
+		to:     t.Recipient(),
+		amount: copyBig(t.Amount()),
+		token:  t.Token(),
+		data:   helper.BytesToHex(t.Data()),
+	}
+	row.req.ID = st.lastID
+	row.req.Status = blockchain.QueuedStatus
+	row.req.Attempts = 0
+	row.req.Error = ""
+	row.req.Transaction = nil
+	st.outbox = append(st.outbox, row)
+
+	req.Status = blockchain.QueuedStatus
+
+	return true, nil
+}
+
+// ClaimSendRequest locks the oldest unfinished request of outbox for lease time, so other workers skip it.
+// Request, that was not finished before lease expired, is claimed again
+func (st *Storage) ClaimSendRequest(lease time.Duration) (*storage.SendRequest, bool, error) {
+	st.Lock()
+	defer st.Unlock()
+
+	now := time.Now()
+	for _, row := range st.outbox {
+		if row.req.Status != blockchain.QueuedStatus && row.req.Status != blockchain.SignedStatus {
+			continue
+		}
+		if !row.lockedUntil.IsZero() && !row.lockedUntil.Before(now) {
+			continue
+		}
+
+		row.lockedUntil = now.Add(lease / time.Second * time.Second)
+		row.req.Attempts++
+
+		req, err := row.sendRequest()
+		if err != nil {
+			return nil, false, fmt.Errorf("error while claiming send request: %v", err)
+		}
+
+		return req, true, nil
+	}
+
+	return nil, false, nil
+}
+
+// CountUnsentRequests returns amount of requests of outbox, that are not sent yet
+func (st *Storage) CountUnsentRequests() (int, error) {
+	st.Lock()
+	defer st.Unlock()
+
+	var count int
+	for _, row := range st.outbox {
+		if row.req.Status == blockchain.QueuedStatus || row.req.Status == blockchain.SignedStatus {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// LoadSendRequestByKey returns request of client with idempotency key
+func (st *Storage) LoadSendRequestByKey(clientID, key string) (*storage.SendRequest, bool, error) {
+	st.Lock()
+	defer st.Unlock()
+
+	for _, row := range st.outbox {
+		if row.req.ClientID != clientID || row.req.IdempotencyKey != key {
+			continue
+		}
+
+		req, err := row.sendRequest()
+		if err != nil {
+			return nil, false, fmt.Errorf("error while selecting send request: %v", err)
+		}
+
+		return req, true, nil
+	}
+
+	return nil, false, nil
+}
+
+// LoadSignedRequests returns requests of outbox, which transactions are signed, but not sent yet
+func (st *Storage) LoadSignedRequests() ([]*storage.SendRequest, error) {
+	st.Lock()
+	defer st.Unlock()
+
+	var reqs []*storage.SendRequest
+	for _, row := range st.outbox {
+		if row.req.Status != blockchain.SignedStatus {
+			continue
+		}
+
+		req, err := row.sendRequest()
+		if err != nil {
+			return nil, fmt.Errorf("error while selecting signed requests: %v", err)
+		}
+		reqs = append(reqs, req)
+	}
+
+	return reqs, nil
+}
+
+// SaveSignedRequest saves signed transaction of new request. Request, that is already signed, is not changed
+func (st *Storage) SaveSignedRequest(id int64, t *blockchain.Transaction) error {
+	st.Lock()
+	defer st.Unlock()
+
+	row := st.outboxRow(id)
+	if row == nil || row.req.Status != blockchain.QueuedStatus {
+		return fmt.Errorf("send request %d is already signed", id)
+	}
+
+	row.req.Status = blockchain.SignedStatus
+	row.hash = t.Hash()
+	row.nonce = int64(t.Nonce())
+	row.gas = int64(t.Gas())
+	row.gasPrice = helper.BigToHex(t.GasPrice())
+	row.maxFee = helper.BigToHex(t.MaxFeePerGas())
+	row.maxTip = helper.BigToHex(t.MaxPriorityFeePerGas())
+	row.raw = helper.BytesToHex(t.Raw())
+
+	return nil
+}
+
+// FinishSendRequest sets status of request, after that request is not sent anymore, with error, if it is dropped
+func (st *Storage) FinishSendRequest(id int64, status, errMsg string) error {
+	st.Lock()
+	defer st.Unlock()
+
+	if row := st.outboxRow(id); row != nil {
+		row.req.Status = status
+		row.req.Error = errMsg
+		row.lockedUntil = time.Time{}
+	}
+
+	return nil
+}
+
+// SaveSendRequestError saves error of attempt to send request, request is tried again after its lease
+func (st *Storage) SaveSendRequestError(id int64, errMsg string) error {
+	st.Lock()
+	defer st.Unlock()
+
+	if row := st.outboxRow(id); row != nil {
+		row.req.Error = errMsg
+	}
+
+	return nil
+}
+
+// SaveTransition saves change of transaction status to history
+func (st *Storage) SaveTransition(tr *blockchain.Transition) error {
+	st.Lock()
+	st.lastID++
+	st.history = append(st.history, &historyRow{id: st.lastID, tr: *tr})
+	st.Unlock()
+
+	return nil
+}
+
+// LoadHistory returns all changes of status of transaction with hash or of send request with ID
+func (st *Storage) LoadHistory(id string) ([]*blockchain.Transition, error) {
+	st.Lock()
+	defer st.Unlock()
+
+	// Records of request before signing are joined with records of its transaction
+	hashes := map[string]bool{id: true}
+	requests := map[string]bool{id: true}
+	for _, row := range st.history {
+		if row.tr.RequestID == id && row.tr.Hash != "" {
+			hashes[row.tr.Hash] = true
+		}
+		if row.tr.Hash == id && row.tr.RequestID != "" {
+			requests[row.tr.RequestID] = true
+		}
+	}
+
+	var rows []*historyRow
+	for _, row := range st.history {
+		if (row.tr.Hash != "" && hashes[row.tr.Hash]) || (row.tr.RequestID != "" && requests[row.tr.RequestID]) {
+			rows = append(rows, row)
+		}
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		if !rows[i].tr.CreatedAt.Equal(rows[j].tr.CreatedAt) {
+			return rows[i].tr.CreatedAt.Before(rows[j].tr.CreatedAt)
+		}
+
+		return rows[i].id < rows[j].id
+	})
+
+	history := make([]*blockchain.Transition, 0, len(rows))
+	for _, row := range rows {
+		tr := row.tr
+		history = append(history, &tr)
+	}
+
+	return history, nil
+}
+
+func (st *Storage) updateEntry(id int64, update func(*entry)) error {
+	st.Lock()
+	defer st.Unlock()
+
+	for _, e := range st.entries {
+		if e.id == id {
+			update(e)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("transaction #%d not updated", id)
+}
+
+func (st *Storage) loadTransactions(match func(*entry) bool) (map[string]*blockchain.Transaction, error) {
+	st.Lock()
+	defer st.Unlock()
+
+	txs := make(map[string]*blockchain.Transaction)
+	for _, e := range st.entries {
+		if !match(e) {
+			continue
+		}
+
+		tx := new(blockchain.Transaction)
+		err := tx.FillFromDB(&blockchain.DBTransaction{
+			ID:            e.id,
+			Hash:          e.hash,
+			BlockHash:     e.blockHash,
+			BlockNumber:   e.blockNumber,
+			From:          e.from,
+			To:            e.to,
+			Confirmations: e.confirmations,
+			Amount:        new(big.Int).Set(&e.amount),
+			Token:         e.token,
+			Status:        e.status,
+			CreatedAt:     e.createdAt,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error while filling transaction: %v", err)
+		}
+
+		txs[tx.Hash()] = tx
+	}
+
+	return txs, nil
+}
+
+func (st *Storage) entryByHash(hash string) *entry {
+	for _, e := range st.entries {
+		if e.hash == hash {
+			return e
+		}
+	}
+
+	return nil
+}
+
+// chainOrigin returns hash of the first transaction of replacement chain, that contains transaction with hash
+func (st *Storage) chainOrigin(hash string) (string, bool) {
+	for _, w := range st.withdraws {
+		if w.hash == hash {
+			return w.origin(), true
+		}
+	}
+
+	return "", false
+}
+
+func (st *Storage) outboxRow(id int64) *outboxRow {
+	for _, row := range st.outbox {
+		if row.req.ID == id {
+			return row
+		}
+	}
+
+	return nil
+}
+
+func (w *withdraw) origin() string {
+	if w.originalHash != "" {
+		return w.originalHash
+	}
+
+	return w.hash
+}
+
+// sendRequest returns copy of request with its transaction
+func (row *outboxRow) sendRequest() (*storage.SendRequest, error) {
+	req := row.req
+	req.Transaction = new(blockchain.Transaction)
+	err := req.Transaction.FillFromWithdraw(&blockchain.DBWithdraw{
+		Hash:     row.hash,
+		From:     row.from,
+		To:       row.to,
+		Amount:   new(big.Int).Set(&row.amount),
+		Token:    row.token,
+		Nonce:    row.nonce,
+		Gas:      row.gas,
+		GasPrice: hexOrZero(row.gasPrice),
+		MaxFee:   hexOrZero(row.maxFee),
+		MaxTip:   hexOrZero(row.maxTip),
+		Data:     row.data,
+		Raw:      row.raw,
+		// Transaction of request has status of request until it is sent
+		Status: row.req.Status,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &req, nil
+}
+
+func hexOrZero(s string) string {
+	if s == "" {
+		return "0x0"
+	}
+
+	return s
+}
+
+// copy returns copy of data for rollback. Rows are copied, because they are changed in place
+func (d *data) copy() *data {
+	c := &data{
+		balances:      make(map[string]big.Int, len(d.balances)),
+		tokenBalances: make(map[string]map[string]big.Int, len(d.tokenBalances)),
+		watched:       make(map[string]bool, len(d.watched)),
+		entries:       make([]*entry, 0, len(d.entries)),
+		withdraws:     make([]*withdraw, 0, len(d.withdraws)),
+		headers:       make(map[int64]*blockchain.Header, len(d.headers)),
+		lastScanned:   d.lastScanned,
+		outbox:        make([]*outboxRow, 0, len(d.outbox)),
+		history:       make([]*historyRow, 0, len(d.history)),
+		lastID:        d.lastID,
+	}
+
+	for addr, bal := range d.balances {
+		c.balances[addr] = copyBig(bal)
+	}
+	for token, balances := range d.tokenBalances {
+		c.tokenBalances[token] = make(map[string]big.Int, len(balances))
+		for addr, bal := range balances {
+			c.tokenBalances[token][addr] = copyBig(bal)
+		}
+	}
+	for addr, ok := range d.watched {
+		c.watched[addr] = ok
+	}
+	for _, e := range d.entries {
+		copied := *e
+		c.entries = append(c.entries, &copied)
+	}
+	for _, w := range d.withdraws {
+		copied := *w
+		c.withdraws = append(c.withdraws, &copied)
+	}
+	// Headers and last scanned block are replaced and never changed in place
+	for number, h := range d.headers {
+		c.headers[number] = h
+	}
+	for _, row := range d.outbox {
+		copied := *row
+		c.outbox = append(c.outbox, &copied)
+	}
+	for _, row := range d.history {
+		copied := *row
+		c.history = append(c.history, &copied)
+	}
+
+	return c
+}
+
+// copyBig returns copy of number, that doesn't share memory with original one
+func copyBig(v big.Int) big.Int {
+	return *new(big.Int).Set(&v)
+}
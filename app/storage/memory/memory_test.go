@@ -0,0 +1,15 @@
+package memory_test
+
+import (
+	"testing"
+
+	"github.com/kainobor/eth-client/app/storage"
+	"github.com/kainobor/eth-client/app/storage/memory"
+	"github.com/kainobor/eth-client/app/storage/storagetest"
+)
+
+func TestStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		return memory.New()
+	})
+}
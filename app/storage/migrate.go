@@ -0,0 +1,295 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/kainobor/eth-client/app/config"
+)
+
+type (
+	// Migration changes schema of database from previous version to its version. Down query reverts it
+	Migration struct {
+		Version  int64
+		Name     string
+		Up       string
+		Down     string
+		Checksum string // Hash of up query, that detects change of migration after it was applied
+	}
+
+	// MigrationStatus is state of migration in database
+	MigrationStatus struct {
+		Migration *Migration
+		Applied   bool
+		AppliedAt time.Time
+	}
+
+	// Migrator applies and reverts migrations of schema. Applied migrations are saved to schema_migrations table
+	Migrator struct {
+		db         *sql.DB
+		migrations []*Migration
+		lockSQL    string // Locks table of migrations, so several instances don't apply the same migration
+	}
+
+	// appliedMigration is row of schema_migrations table
+	appliedMigration struct {
+		name      string
+		checksum  string
+		appliedAt time.Time
+	}
+)
+
+// migrationFiles contains migrations of each driver in directory with name of driver
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// migrationFileRegexp matches name of migration file like 0001_init.up.sql
+var migrationFileRegexp = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// NewMigrator connects to database of configured driver without applying migrations
+func NewMigrator(config *config.StorageConfig) (*Migrator, error) {
+	switch config.Driver {
+	case "", PostgresDriver:
+		st := NewPostgres(config)
+		if err := st.open(); err != nil {
+			return nil, err
+		}
+		return st.migrator()
+	case SQLiteDriver:
+		st := NewSQLite(config)
+		if err := st.open(); err != nil {
+			return nil, err
+		}
+		return st.migrator()
+	default:
+		return nil, fmt.Errorf("unknown storage driver `%s`", config.Driver)
+	}
+}
+
+// newMigrator is constructor for migrator of driver, migrations are loaded from embedded files
+func newMigrator(db *sql.DB, driver, lockSQL string) (*Migrator, error) {
+	migrations, err := loadMigrations(migrationFiles, path.Join("migrations", driver))
+	if err != nil {
+		return nil, fmt.Errorf("error while loading migrations: %v", err)
+	}
+
+	return &Migrator{db: db, migrations: migrations, lockSQL: lockSQL}, nil
+}
+
+// loadMigrations reads migrations from directory and sorts them by version. Every migration must have up and down files
+func loadMigrations(fsys fs.FS, dir string) ([]*Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		matches := migrationFileRegexp.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || matches == nil {
+			return nil, fmt.Errorf("unexpected file `%s` in migrations", entry.Name())
+		}
+
+		version, err := strconv.ParseInt(matches[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("wrong version of migration `%s`: %v", entry.Name(), err)
+		}
+		query, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: matches[2]}
+			byVersion[version] = m
+		} else if m.Name != matches[2] {
+			return nil, fmt.Errorf("migrations `%s` and `%s` have the same version %d", m.Name, matches[2], version)
+		}
+
+		if matches[3] == "up" {
+			m.Up = string(query)
+			hash := sha256.Sum256(query)
+			m.Checksum = hex.EncodeToString(hash[:])
+		} else {
+			m.Down = string(query)
+		}
+	}
+
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d `%s` must have both up and down files", m.Version, m.Name)
+		}
+		migrations = append(migrations, m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// Up applies all migrations, that are not applied yet, and returns amount of applied ones
+func (m *Migrator) Up() (int, error) {
+	applied, err := m.check()
+	if err != nil {
+		return 0, err
+	}
+
+	var count int
+	for _, mig := range m.migrations {
+		if _, ok := applied[mig.Version]; ok {
+			continue
+		}
+
+		done, err := m.apply(mig, true)
+		if err != nil {
+			return count, fmt.Errorf("error while applying migration %d `%s`: %v", mig.Version, mig.Name, err)
+		} else if done {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// Down reverts some amount of the latest applied migrations and returns amount of reverted ones
+func (m *Migrator) Down(steps int) (int, error) {
+	applied, err := m.check()
+	if err != nil {
+		return 0, err
+	}
+
+	var count int
+	for i := len(m.migrations) - 1; i >= 0 && count < steps; i-- {
+		mig := m.migrations[i]
+		if _, ok := applied[mig.Version]; !ok {
+			continue
+		}
+
+		done, err := m.apply(mig, false)
+		if err != nil {
+			return count, fmt.Errorf("error while reverting migration %d `%s`: %v", mig.Version, mig.Name, err)
+		} else if done {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// Status returns all known migrations with time of applying
+func (m *Migrator) Status() ([]*MigrationStatus, error) {
+	applied, err := m.check()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]*MigrationStatus, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		status := &MigrationStatus{Migration: mig}
+		if a, ok := applied[mig.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = a.appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// Close connection to database
+func (m *Migrator) Close() error {
+	return m.db.Close()
+}
+
+// check returns applied migrations by versions. Error is returned if applied migration was changed
+// or is unknown, because then schema differs from the one, that queries expect
+func (m *Migrator) check() (map[int64]*appliedMigration, error) {
+	if _, err := m.db.Exec(CreateMigrationsTableSQL); err != nil {
+		return nil, fmt.Errorf("error while creating table of migrations: %v", err)
+	}
+
+	rows, err := m.db.Query(SelectMigrationsSQL)
+	if err != nil {
+		return nil, fmt.Errorf("error while selecting applied migrations: %v", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]*appliedMigration)
+	for rows.Next() {
+		var version int64
+		a := new(appliedMigration)
+		if err := rows.Scan(&version, &a.name, &a.checksum, &a.appliedAt); err != nil {
+			return nil, fmt.Errorf("error while scanning applied migration: %v", err)
+		}
+		applied[version] = a
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error while selecting applied migrations: %v", err)
+	}
+
+	known := make(map[int64]*Migration, len(m.migrations))
+	for _, mig := range m.migrations {
+		known[mig.Version] = mig
+	}
+	for version, a := range applied {
+		mig, ok := known[version]
+		if !ok {
+			return nil, fmt.Errorf("applied migration %d `%s` is unknown, database is newer than application", version, a.name)
+		} else if mig.Checksum != a.checksum {
+			return nil, fmt.Errorf("migration %d `%s` was changed after applying: checksum %s, applied %s", version, mig.Name, mig.Checksum, a.checksum)
+		}
+	}
+
+	return applied, nil
+}
+
+// apply runs up or down query of migration in transaction. False is returned if other instance already did it
+func (m *Migrator) apply(mig *Migration, up bool) (bool, error) {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if m.lockSQL != "" {
+		if _, err := tx.Exec(m.lockSQL); err != nil {
+			return false, fmt.Errorf("error while locking migrations: %v", err)
+		}
+	}
+
+	var applied bool
+	if err := tx.QueryRow(SelectMigrationAppliedSQL, mig.Version).Scan(&applied); err != nil {
+		return false, fmt.Errorf("error while checking migration: %v", err)
+	}
+	if applied == up {
+		return false, nil
+	}
+
+	if up {
+		if _, err := tx.Exec(mig.Up); err != nil {
+			return false, err
+		}
+		_, err = tx.Exec(InsertMigrationSQL, mig.Version, mig.Name, mig.Checksum, time.Now().UTC())
+	} else {
+		if _, err := tx.Exec(mig.Down); err != nil {
+			return false, err
+		}
+		_, err = tx.Exec(DeleteMigrationSQL, mig.Version)
+	}
+	if err != nil {
+		return false, fmt.Errorf("error while saving migration: %v", err)
+	}
+
+	return true, tx.Commit()
+}
@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS transaction_history;
+DROP TABLE IF EXISTS send_outbox;
+DROP TABLE IF EXISTS transactions_withdraw;
+DROP TABLE IF EXISTS transactions_entry;
+DROP TABLE IF EXISTS token_balance;
+DROP TABLE IF EXISTS block_header;
+DROP TABLE IF EXISTS block_scanner;
+DROP TABLE IF EXISTS watch_address;
+DROP TABLE IF EXISTS eth_balance;
@@ -0,0 +1,141 @@
+-- Tables existed before migrations were introduced, so they are created only if they are absent.
+-- Tables of database, that was created from old fixtures.sql, get new columns before their indexes are created
+
+CREATE TABLE IF NOT EXISTS eth_balance (
+  id serial PRIMARY KEY,
+  address character varying(42) NOT NULL,
+  balance character varying(255) NOT NULL
+);
+COMMENT ON TABLE eth_balance IS 'All known balances';
+CREATE UNIQUE INDEX IF NOT EXISTS balance_address_uindex ON eth_balance USING btree (address);
+
+CREATE TABLE IF NOT EXISTS watch_address (
+  id serial PRIMARY KEY,
+  address character varying(42) NOT NULL,
+  created_at timestamp without time zone
+);
+COMMENT ON TABLE watch_address IS 'Addresses which incoming transactions are tracked';
+CREATE UNIQUE INDEX IF NOT EXISTS watch_address_address_uindex ON watch_address USING btree (address);
+
+CREATE TABLE IF NOT EXISTS block_scanner (
+  id smallint PRIMARY KEY,
+  last_block bigint NOT NULL
+);
+COMMENT ON TABLE block_scanner IS 'Progress of scanning blocks for deposits';
+
+CREATE TABLE IF NOT EXISTS block_header (
+  number bigint PRIMARY KEY,
+  hash character varying(66) NOT NULL,
+  parent_hash character varying(66) NOT NULL
+);
+COMMENT ON TABLE block_header IS 'Recent headers of main chain for reorganization detection';
+
+CREATE TABLE IF NOT EXISTS token_balance (
+  id serial PRIMARY KEY,
+  address character varying(42) NOT NULL,
+  token character varying(42) NOT NULL,
+  balance character varying(255) NOT NULL
+);
+COMMENT ON TABLE token_balance IS 'All known balances of ERC-20 tokens';
+CREATE UNIQUE INDEX IF NOT EXISTS token_balance_address_token_uindex ON token_balance USING btree (address, token);
+
+CREATE TABLE IF NOT EXISTS transactions_entry (
+  id serial PRIMARY KEY,
+  hash character varying(66) NOT NULL,
+  block_hash character varying(66),
+  block_number bigint,
+  from_addr character varying(42),
+  to_addr character varying(42),
+  confirmations integer NOT NULL,
+  amount character varying(255),
+  token character varying(42),
+  status character varying(16) DEFAULT 'broadcast' NOT NULL,
+  showed boolean DEFAULT false NOT NULL,
+  receipt_status boolean,
+  gas_used bigint,
+  effective_gas_price character varying(255),
+  contract_address character varying(42),
+  created_at timestamp without time zone
+);
+ALTER TABLE transactions_entry
+  ADD COLUMN IF NOT EXISTS token character varying(42),
+  ADD COLUMN IF NOT EXISTS receipt_status boolean,
+  ADD COLUMN IF NOT EXISTS gas_used bigint,
+  ADD COLUMN IF NOT EXISTS effective_gas_price character varying(255),
+  ADD COLUMN IF NOT EXISTS contract_address character varying(42),
+  ALTER COLUMN status TYPE character varying(16),
+  ALTER COLUMN status SET DEFAULT 'broadcast';
+CREATE INDEX IF NOT EXISTS transactions_entry_hash_index ON transactions_entry USING btree (hash);
+
+CREATE TABLE IF NOT EXISTS transactions_withdraw (
+  id serial PRIMARY KEY,
+  hash character varying(66) NOT NULL,
+  from_addr character varying(42),
+  to_addr character varying(42),
+  amount character varying(255),
+  token character varying(42),
+  gas bigint,
+  gas_price character varying(255),
+  max_fee_per_gas character varying(255),
+  max_priority_fee_per_gas character varying(255),
+  nonce bigint,
+  data text,
+  raw text,
+  replaces character varying(66),
+  original_hash character varying(66),
+  created_at timestamp without time zone
+);
+ALTER TABLE transactions_withdraw
+  ADD COLUMN IF NOT EXISTS token character varying(42),
+  ADD COLUMN IF NOT EXISTS gas bigint,
+  ADD COLUMN IF NOT EXISTS gas_price character varying(255),
+  ADD COLUMN IF NOT EXISTS max_fee_per_gas character varying(255),
+  ADD COLUMN IF NOT EXISTS max_priority_fee_per_gas character varying(255),
+  ADD COLUMN IF NOT EXISTS nonce bigint,
+  ADD COLUMN IF NOT EXISTS data text,
+  ADD COLUMN IF NOT EXISTS raw text,
+  ADD COLUMN IF NOT EXISTS replaces character varying(66),
+  ADD COLUMN IF NOT EXISTS original_hash character varying(66);
+CREATE INDEX IF NOT EXISTS transactions_withdraw_hash_index ON transactions_withdraw USING btree (hash);
+CREATE INDEX IF NOT EXISTS transactions_withdraw_original_hash_index ON transactions_withdraw USING btree (original_hash);
+
+CREATE TABLE IF NOT EXISTS send_outbox (
+  id serial PRIMARY KEY,
+  request_id character varying(32) NOT NULL,
+  client_id character varying(64) DEFAULT '' NOT NULL,
+  idempotency_key character varying(255),
+  payload_hash character varying(64),
+  status character varying(16) NOT NULL,
+  attempts integer DEFAULT 0 NOT NULL,
+  error text,
+  locked_until timestamp without time zone,
+  hash character varying(66),
+  from_addr character varying(42) NOT NULL,
+  to_addr character varying(42) NOT NULL,
+  amount character varying(255) NOT NULL,
+  token character varying(42),
+  data text,
+  nonce bigint,
+  gas bigint,
+  gas_price character varying(255),
+  max_fee_per_gas character varying(255),
+  max_priority_fee_per_gas character varying(255),
+  raw text,
+  created_at timestamp without time zone
+);
+COMMENT ON TABLE send_outbox IS 'Accepted send requests, that are kept until their transactions are sent';
+CREATE UNIQUE INDEX IF NOT EXISTS send_outbox_request_id_uindex ON send_outbox USING btree (request_id);
+CREATE UNIQUE INDEX IF NOT EXISTS send_outbox_client_id_idempotency_key_uindex ON send_outbox USING btree (client_id, idempotency_key);
+CREATE INDEX IF NOT EXISTS send_outbox_status_index ON send_outbox USING btree (status);
+
+CREATE TABLE IF NOT EXISTS transaction_history (
+  id serial PRIMARY KEY,
+  request_id character varying(32),
+  hash character varying(66),
+  from_status character varying(16),
+  to_status character varying(16) NOT NULL,
+  created_at timestamp without time zone NOT NULL
+);
+COMMENT ON TABLE transaction_history IS 'Changes of statuses of transactions and send requests';
+CREATE INDEX IF NOT EXISTS transaction_history_hash_index ON transaction_history USING btree (hash);
+CREATE INDEX IF NOT EXISTS transaction_history_request_id_index ON transaction_history USING btree (request_id);
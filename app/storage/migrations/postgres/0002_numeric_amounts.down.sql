@@ -0,0 +1,24 @@
+CREATE OR REPLACE FUNCTION pg_temp.numeric_to_hex(num numeric) RETURNS text AS $$
+DECLARE
+  result text := '';
+BEGIN
+  IF num IS NULL THEN
+    RETURN NULL;
+  ELSIF num = 0 THEN
+    RETURN '0x0';
+  END IF;
+
+  WHILE num > 0 LOOP
+    result := substr('0123456789abcdef', (num % 16)::integer + 1, 1) || result;
+    num := div(num, 16);
+  END LOOP;
+
+  RETURN '0x' || result;
+END
+$$ LANGUAGE plpgsql IMMUTABLE;
+
+ALTER TABLE eth_balance ALTER COLUMN balance TYPE character varying(255) USING pg_temp.numeric_to_hex(balance);
+ALTER TABLE token_balance ALTER COLUMN balance TYPE character varying(255) USING pg_temp.numeric_to_hex(balance);
+ALTER TABLE transactions_entry ALTER COLUMN amount TYPE character varying(255) USING pg_temp.numeric_to_hex(amount);
+ALTER TABLE transactions_withdraw ALTER COLUMN amount TYPE character varying(255) USING pg_temp.numeric_to_hex(amount);
+ALTER TABLE send_outbox ALTER COLUMN amount TYPE character varying(255) USING pg_temp.numeric_to_hex(amount);
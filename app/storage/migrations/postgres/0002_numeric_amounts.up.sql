@@ -0,0 +1,29 @@
+-- Amounts and balances were saved as hex strings, numbers of wei can be summed and compared by database
+
+CREATE OR REPLACE FUNCTION pg_temp.hex_to_numeric(hex text) RETURNS numeric AS $$
+DECLARE
+  result numeric := 0;
+  digit text;
+  value integer;
+BEGIN
+  IF hex IS NULL THEN
+    RETURN NULL;
+  END IF;
+
+  FOREACH digit IN ARRAY regexp_split_to_array(lower(regexp_replace(hex, '^0x', '', 'i')), '') LOOP
+    value := strpos('0123456789abcdef', digit) - 1;
+    IF value < 0 THEN
+      RAISE EXCEPTION 'wrong hex number `%`', hex;
+    END IF;
+    result := result * 16 + value;
+  END LOOP;
+
+  RETURN result;
+END
+$$ LANGUAGE plpgsql IMMUTABLE;
+
+ALTER TABLE eth_balance ALTER COLUMN balance TYPE numeric(78,0) USING pg_temp.hex_to_numeric(balance);
+ALTER TABLE token_balance ALTER COLUMN balance TYPE numeric(78,0) USING pg_temp.hex_to_numeric(balance);
+ALTER TABLE transactions_entry ALTER COLUMN amount TYPE numeric(78,0) USING pg_temp.hex_to_numeric(amount);
+ALTER TABLE transactions_withdraw ALTER COLUMN amount TYPE numeric(78,0) USING pg_temp.hex_to_numeric(amount);
+ALTER TABLE send_outbox ALTER COLUMN amount TYPE numeric(78,0) USING pg_temp.hex_to_numeric(amount);
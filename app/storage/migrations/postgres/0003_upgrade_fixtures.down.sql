@@ -0,0 +1,3 @@
+-- Upgraded database is not turned back to old one, because old statuses don't describe new lifecycle.
+-- Statuses of new database are not changed by up migration, so nothing is reverted
+SELECT 1;
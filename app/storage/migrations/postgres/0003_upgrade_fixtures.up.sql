@@ -0,0 +1,11 @@
+-- Database, that was created from old fixtures.sql, has old statuses of transactions.
+-- Its columns are added by the first migration. For new database this migration changes nothing
+
+-- Old pending transactions are tracked further as broadcast or mined ones, so payments in progress are not lost
+UPDATE transactions_entry SET status = CASE
+    WHEN COALESCE(block_hash, '') = '' THEN 'broadcast'
+    ELSE 'mined'
+  END
+  WHERE status = 'pending';
+UPDATE transactions_entry SET status = 'confirmed' WHERE status = 'success';
+UPDATE transactions_entry SET status = 'dropped' WHERE status = 'fail';
@@ -0,0 +1,112 @@
+CREATE TABLE IF NOT EXISTS eth_balance (
+  id INTEGER PRIMARY KEY,
+  address varchar(42) NOT NULL,
+  balance varchar(255) NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS balance_address_uindex ON eth_balance (address);
+
+CREATE TABLE IF NOT EXISTS watch_address (
+  id INTEGER PRIMARY KEY,
+  address varchar(42) NOT NULL,
+  created_at timestamp
+);
+CREATE UNIQUE INDEX IF NOT EXISTS watch_address_address_uindex ON watch_address (address);
+
+CREATE TABLE IF NOT EXISTS block_scanner (
+  id smallint PRIMARY KEY,
+  last_block bigint NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS block_header (
+  number bigint PRIMARY KEY,
+  hash varchar(66) NOT NULL,
+  parent_hash varchar(66) NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS token_balance (
+  id INTEGER PRIMARY KEY,
+  address varchar(42) NOT NULL,
+  token varchar(42) NOT NULL,
+  balance varchar(255) NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS token_balance_address_token_uindex ON token_balance (address, token);
+
+CREATE TABLE IF NOT EXISTS transactions_entry (
+  id INTEGER PRIMARY KEY,
+  hash varchar(66) NOT NULL,
+  block_hash varchar(66),
+  block_number bigint,
+  from_addr varchar(42),
+  to_addr varchar(42),
+  confirmations integer NOT NULL,
+  amount varchar(255),
+  token varchar(42),
+  status varchar(16) DEFAULT 'broadcast' NOT NULL,
+  showed boolean DEFAULT FALSE NOT NULL,
+  receipt_status boolean,
+  gas_used bigint,
+  effective_gas_price varchar(255),
+  contract_address varchar(42),
+  created_at timestamp
+);
+CREATE INDEX IF NOT EXISTS transactions_entry_hash_index ON transactions_entry (hash);
+
+CREATE TABLE IF NOT EXISTS transactions_withdraw (
+  id INTEGER PRIMARY KEY,
+  hash varchar(66) NOT NULL,
+  from_addr varchar(42),
+  to_addr varchar(42),
+  amount varchar(255),
+  token varchar(42),
+  gas bigint,
+  gas_price varchar(255),
+  max_fee_per_gas varchar(255),
+  max_priority_fee_per_gas varchar(255),
+  nonce bigint,
+  data text,
+  raw text,
+  replaces varchar(66),
+  original_hash varchar(66),
+  created_at timestamp
+);
+CREATE INDEX IF NOT EXISTS transactions_withdraw_hash_index ON transactions_withdraw (hash);
+CREATE INDEX IF NOT EXISTS transactions_withdraw_original_hash_index ON transactions_withdraw (original_hash);
+
+CREATE TABLE IF NOT EXISTS send_outbox (
+  id INTEGER PRIMARY KEY,
+  request_id varchar(32) NOT NULL,
+  client_id varchar(64) DEFAULT '' NOT NULL,
+  idempotency_key varchar(255),
+  payload_hash varchar(64),
+  status varchar(16) NOT NULL,
+  attempts integer DEFAULT 0 NOT NULL,
+  error text,
+  locked_until timestamp,
+  hash varchar(66),
+  from_addr varchar(42) NOT NULL,
+  to_addr varchar(42) NOT NULL,
+  amount varchar(255) NOT NULL,
+  token varchar(42),
+  data text,
+  nonce bigint,
+  gas bigint,
+  gas_price varchar(255),
+  max_fee_per_gas varchar(255),
+  max_priority_fee_per_gas varchar(255),
+  raw text,
+  created_at timestamp
+);
+CREATE UNIQUE INDEX IF NOT EXISTS send_outbox_request_id_uindex ON send_outbox (request_id);
+CREATE UNIQUE INDEX IF NOT EXISTS send_outbox_client_id_idempotency_key_uindex ON send_outbox (client_id, idempotency_key);
+CREATE INDEX IF NOT EXISTS send_outbox_status_index ON send_outbox (status);
+
+CREATE TABLE IF NOT EXISTS transaction_history (
+  id INTEGER PRIMARY KEY,
+  request_id varchar(32),
+  hash varchar(66),
+  from_status varchar(16),
+  to_status varchar(16) NOT NULL,
+  created_at timestamp NOT NULL
+);
+CREATE INDEX IF NOT EXISTS transaction_history_hash_index ON transaction_history (hash);
+CREATE INDEX IF NOT EXISTS transaction_history_request_id_index ON transaction_history (request_id);
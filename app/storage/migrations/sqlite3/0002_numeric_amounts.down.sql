@@ -0,0 +1,5 @@
+UPDATE eth_balance SET balance = decimal_to_hex(balance);
+UPDATE token_balance SET balance = decimal_to_hex(balance);
+UPDATE transactions_entry SET amount = decimal_to_hex(amount) WHERE amount IS NOT NULL;
+UPDATE transactions_withdraw SET amount = decimal_to_hex(amount) WHERE amount IS NOT NULL;
+UPDATE send_outbox SET amount = decimal_to_hex(amount);
@@ -0,0 +1,8 @@
+-- SQLite has no numbers of such size, so amounts and balances are kept as decimal text.
+-- Functions of conversion are registered by application for its connections
+
+UPDATE eth_balance SET balance = hex_to_decimal(balance);
+UPDATE token_balance SET balance = hex_to_decimal(balance);
+UPDATE transactions_entry SET amount = hex_to_decimal(amount) WHERE amount IS NOT NULL;
+UPDATE transactions_withdraw SET amount = hex_to_decimal(amount) WHERE amount IS NOT NULL;
+UPDATE send_outbox SET amount = hex_to_decimal(amount);
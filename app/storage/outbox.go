@@ -0,0 +1,183 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/kainobor/eth-client/app/blockchain"
+	"github.com/kainobor/eth-client/app/helper"
+)
+
+// AddSendRequest saves request with transaction, that is not signed yet, to outbox.
+// False is returned if client already has request with the same idempotency key
+func (st *sqlStorage) AddSendRequest(req *SendRequest) (bool, error) {
+	t := req.Transaction
+	res, err := st.db.Exec(
+		InsertSendRequestSQL,
+		req.RequestID,
+		req.ClientID,
+		nullString(req.IdempotencyKey),
+		nullString(req.PayloadHash),
+		t.From(),
+		t.Recipient(),
+		weiValue(t.Amount()),
+		nullString(t.Token()),
+		helper.BytesToHex(t.Data()),
+		blockchain.QueuedStatus,
+	)
+	if err != nil {
+		return false, fmt.Errorf("error while adding send request: %v", err)
+	}
+
+	cnt, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error while checking send request adding: %v", err)
+	}
+	req.Status = blockchain.QueuedStatus
+
+	return cnt == 1, nil
+}
+
+// ClaimSendRequest locks the oldest unfinished request of outbox for lease time, so other workers skip it.
+// Request, that was not finished before lease expired, is claimed again
+func (st *Postgres) ClaimSendRequest(lease time.Duration) (*SendRequest, bool, error) {
+	row := st.db.QueryRow(ClaimSendRequestSQL, int64(lease/time.Second), blockchain.QueuedStatus, blockchain.SignedStatus)
+	req, ok, err := scanSendRequest(row)
+	if err != nil {
+		return nil, false, fmt.Errorf("error while claiming send request: %v", err)
+	}
+
+	return req, ok, nil
+}
+
+// CountUnsentRequests returns amount of requests of outbox, that are not sent yet
+func (st *sqlStorage) CountUnsentRequests() (int, error) {
+	var count int
+	if err := st.db.QueryRow(SelectUnsentRequestsCountSQL, blockchain.QueuedStatus, blockchain.SignedStatus).Scan(&count); err != nil {
+		return 0, fmt.Errorf("error while counting unsent requests: %v", err)
+	}
+
+	return count, nil
+}
+
+// LoadSendRequestByKey returns request of client with idempotency key
+func (st *sqlStorage) LoadSendRequestByKey(clientID, key string) (*SendRequest, bool, error) {
+	req, ok, err := scanSendRequest(st.db.QueryRow(SelectSendRequestByKeySQL, clientID, key))
+	if err != nil {
+		return nil, false, fmt.Errorf("error while selecting send request: %v", err)
+	}
+
+	return req, ok, nil
+}
+
+// LoadSignedRequests returns requests of outbox, which transactions are signed, but not sent yet
+func (st *sqlStorage) LoadSignedRequests() ([]*SendRequest, error) {
+	rows, err := st.db.Query(SelectSendRequestsByStatusSQL, blockchain.SignedStatus)
+	if err != nil {
+		return nil, fmt.Errorf("error while selecting signed requests: %v", err)
+	}
+	defer rows.Close()
+
+	var reqs []*SendRequest
+	for rows.Next() {
+		req, _, err := scanSendRequest(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error while scanning signed request: %v", err)
+		}
+		reqs = append(reqs, req)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error while selecting signed requests: %v", err)
+	}
+
+	return reqs, nil
+}
+
+// scanSendRequest scans row of outbox. False is returned if single row is not found
+func scanSendRequest(row rowScanner) (*SendRequest, bool, error) {
+	req := new(SendRequest)
+	dbw := new(blockchain.DBWithdraw)
+	err := row.Scan(
+		&req.ID,
+		&req.RequestID,
+		&req.ClientID,
+		&req.IdempotencyKey,
+		&req.PayloadHash,
+		&req.Status,
+		&req.Attempts,
+		&req.Error,
+		&dbw.Hash,
+		&dbw.From,
+		&dbw.To,
+		scanWei(&dbw.Amount),
+		&dbw.Token,
+		&dbw.Nonce,
+		&dbw.Gas,
+		&dbw.GasPrice,
+		&dbw.MaxFee,
+		&dbw.MaxTip,
+		&dbw.Data,
+		&dbw.Raw,
+	)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	// Transaction of request has status of request until it is sent
+	dbw.Status = req.Status
+	req.Transaction = new(blockchain.Transaction)
+	if err := req.Transaction.FillFromWithdraw(dbw); err != nil {
+		return nil, false, err
+	}
+
+	return req, true, nil
+}
+
+// SaveSignedRequest saves signed transaction of new request. Request, that is already signed, is not changed
+func (st *sqlStorage) SaveSignedRequest(id int64, t *blockchain.Transaction) error {
+	res, err := st.db.Exec(
+		UpdateSendRequestSignedSQL,
+		blockchain.SignedStatus,
+		t.Hash(),
+		int64(t.Nonce()),
+		int64(t.Gas()),
+		helper.BigToHex(t.GasPrice()),
+		helper.BigToHex(t.MaxFeePerGas()),
+		helper.BigToHex(t.MaxPriorityFeePerGas()),
+		helper.BytesToHex(t.Raw()),
+		id,
+		blockchain.QueuedStatus,
+	)
+	if err != nil {
+		return fmt.Errorf("error while saving signed request: %v", err)
+	}
+
+	if cnt, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("error while checking signed request saving: %v", err)
+	} else if cnt != 1 {
+		return fmt.Errorf("send request %d is already signed", id)
+	}
+
+	return nil
+}
+
+// FinishSendRequest sets status of request, after that request is not sent anymore, with error, if it is dropped
+func (st *sqlStorage) FinishSendRequest(id int64, status, errMsg string) error {
+	if _, err := st.db.Exec(UpdateSendRequestStatusSQL, status, nullString(errMsg), id); err != nil {
+		return fmt.Errorf("error while finishing send request: %v", err)
+	}
+
+	return nil
+}
+
+// SaveSendRequestError saves error of attempt to send request, request is tried again after its lease
+func (st *sqlStorage) SaveSendRequestError(id int64, errMsg string) error {
+	if _, err := st.db.Exec(UpdateSendRequestErrorSQL, errMsg, id); err != nil {
+		return fmt.Errorf("error while saving send request error: %v", err)
+	}
+
+	return nil
+}
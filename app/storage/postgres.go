@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/kainobor/eth-client/app/blockchain"
+	"github.com/kainobor/eth-client/app/config"
+	"github.com/lib/pq"
+)
+
+type (
+	// Postgres is storage in PostgreSQL database
+	Postgres struct {
+		sqlStorage
+	}
+)
+
+var _ Storage = (*Postgres)(nil)
+
+// defaultSchema contains tables if schema of network is not set
+const defaultSchema = "eth_client"
+
+// NewPostgres is constructor for storage in PostgreSQL
+func NewPostgres(config *config.StorageConfig) *Postgres {
+	return &Postgres{sqlStorage{config: config}}
+}
+
+// Connect to DB and apply migrations, that are not applied yet
+func (st *Postgres) Connect() error {
+	if err := st.open(); err != nil {
+		return err
+	}
+
+	m, err := st.migrator()
+	if err != nil {
+		return err
+	}
+	if _, err := m.Up(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// open connects to DB and creates schema of network, if it doesn't exist
+func (st *Postgres) open() error {
+	var err error
+	if st.conn, err = sql.Open(PostgresDriver, connectString(st.config)); err != nil {
+		return fmt.Errorf("storage connectiong error: %v", err)
+	}
+	st.db = st.conn
+
+	if err = st.conn.Ping(); err != nil {
+		return fmt.Errorf("storage is not responding: %v", err)
+	}
+
+	if _, err = st.db.Exec(fmt.Sprintf(CreateSchemaSQL, pq.QuoteIdentifier(schemaName(st.config)))); err != nil {
+		return fmt.Errorf("error while creating schema: %v", err)
+	}
+
+	return nil
+}
+
+func (st *Postgres) migrator() (*Migrator, error) {
+	return newMigrator(st.conn, PostgresDriver, LockMigrationsSQL)
+}
+
+// WithTx runs fn with storage, that works in transaction. Changes are committed if fn returns nil
+func (st *Postgres) WithTx(fn func(tx Storage) error) error {
+	return st.transaction(func(tx *sqlStorage) error {
+		return fn(&Postgres{*tx})
+	})
+}
+
+// SaveEntryTransaction inserts entry transaction to DB and renews transaction ID
+func (st *Postgres) SaveEntryTransaction(t *blockchain.Transaction) error {
+	blockNum := t.BlockNumber()
+	var insertedID int64
+	err := st.db.QueryRow(
+		InsertEntryTransactionSQL,
+		t.Hash(),
+		t.BlockHash(),
+		(&blockNum).Int64(),
+		t.From(),
+		t.Recipient(),
+		t.CreatedAt(),
+		weiValue(t.Amount()),
+		nullString(t.Token()),
+		t.Status(),
+	).Scan(&insertedID)
+	if err != nil {
+		return fmt.Errorf("transaction `%s` not inserted: %v", t.Hash(), err)
+	}
+
+	t.SetID(insertedID)
+
+	return nil
+}
+
+// ResolveReplacements marks other unmined transactions of replacement chain of mined transaction
+// as replaced and returns their previous statuses by hashes
+func (st *Postgres) ResolveReplacements(minedHash string) (map[string]string, error) {
+	rows, err := st.db.Query(
+		ResolveReplacementsSQL,
+		blockchain.ReplacedStatus,
+		blockchain.BroadcastStatus,
+		blockchain.ReorgedStatus,
+		blockchain.DroppedStatus,
+		minedHash,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error while resolving replacements: %v", err)
+	}
+	defer rows.Close()
+
+	replaced := make(map[string]string)
+	for rows.Next() {
+		var hash, status string
+		if err := rows.Scan(&hash, &status); err != nil {
+			return nil, fmt.Errorf("error while scanning replaced transaction: %v", err)
+		}
+		replaced[hash] = status
+	}
+
+	return replaced, rows.Err()
+}
+
+// schemaName returns schema with tables of network
+func schemaName(config *config.StorageConfig) string {
+	if config.Schema == "" {
+		return defaultSchema
+	}
+
+	return config.Schema
+}
+
+func connectString(config *config.StorageConfig) string {
+	schema := schemaName(config)
+
+	// Tables are found in schema of network, so each network has own data
+	return fmt.Sprintf(
+		"host=%s port=%d user=%s password=%s dbname=%s search_path=%s sslmode=disable",
+		config.IP, config.Port, config.User, config.Password, config.DBName, schema,
+	)
+}
@@ -0,0 +1,195 @@
+package storage_test
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kainobor/eth-client/app/blockchain"
+	"github.com/kainobor/eth-client/app/config"
+	"github.com/kainobor/eth-client/app/storage"
+	"github.com/kainobor/eth-client/app/storage/storagetest"
+	"github.com/lib/pq"
+)
+
+// postgresDSNEnv is environment variable with connection string of test database like
+// "host=localhost port=5432 user=postgres password=secret dbname=eth_client_test"
+const postgresDSNEnv = "ETH_CLIENT_TEST_POSTGRES_DSN"
+
+// fixturesFile is schema of database from times before migrations, with tables in eth_client schema
+const fixturesFile = "testdata/fixtures.sql"
+
+func TestPostgres(t *testing.T) {
+	dsn, c := postgresTestConfig(t)
+
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		// Every test gets own schema, that is dropped after it
+		tc := *c
+		tc.Schema = fmt.Sprintf("storagetest_%d", time.Now().UnixNano())
+		st := storage.NewPostgres(&tc)
+		if err := st.Connect(); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			st.Close()
+			dropSchema(t, dsn, tc.Schema)
+		})
+
+		return st
+	})
+}
+
+func TestPostgresUpgradesFixtures(t *testing.T) {
+	dsn, c := postgresTestConfig(t)
+	c.Schema = fmt.Sprintf("fixtures_%d", time.Now().UnixNano())
+	t.Cleanup(func() { dropSchema(t, dsn, c.Schema) })
+
+	fixtures, err := ioutil.ReadFile(fixturesFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Owner of tables is user of test database
+	var lines []string
+	for _, line := range strings.Split(string(fixtures), "\n") {
+		if !strings.Contains(line, "OWNER TO") {
+			lines = append(lines, line)
+		}
+	}
+	schema := pq.QuoteIdentifier(c.Schema)
+	dump := strings.Replace(strings.Join(lines, "\n"), "eth_client.", schema+".", -1)
+
+	db := openDB(t, dsn)
+	defer db.Close()
+	queries := []string{
+		"CREATE SCHEMA " + schema,
+		dump,
+		// Rows as old application saved them
+		`INSERT INTO ` + schema + `.transactions_entry (hash, block_hash, block_number, from_addr, to_addr, confirmations, amount, status, created_at) VALUES
+			('0x01', '', 0, 'aa', 'bb', 0, '0x1', 'pending', now()),
+			('0x02', '0xb2', 2, 'aa', 'bb', 1, '0x2', 'pending', now()),
+			('0x03', '0xb3', 3, 'aa', 'bb', 12, '0xff', 'success', now()),
+			('0x04', '', 0, 'aa', 'bb', 0, '0x4', 'fail', now())`,
+		`INSERT INTO ` + schema + `.transactions_withdraw (hash, from_addr, to_addr, amount, created_at) VALUES ('0x01', 'aa', 'bb', '0x1', now())`,
+	}
+	for _, query := range queries {
+		if _, err := db.Exec(query); err != nil {
+			t.Fatalf("can't load fixtures: %v", err)
+		}
+	}
+
+	st := storage.NewPostgres(c)
+	if err := st.Connect(); err != nil {
+		t.Fatalf("can't upgrade database from fixtures: %v", err)
+	}
+	defer st.Close()
+
+	active, err := st.LoadActiveTransactions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"0x01": blockchain.BroadcastStatus, "0x02": blockchain.MinedStatus, "0x04": blockchain.DroppedStatus}
+	if len(active) != len(expected) {
+		t.Errorf("expected %d active transactions, got %d", len(expected), len(active))
+	}
+	for hash, status := range expected {
+		if tx, ok := active[hash]; !ok || tx.Status() != status {
+			t.Errorf("expected status `%s` of transaction `%s`", status, hash)
+		}
+	}
+
+	var status, amount string
+	err = db.QueryRow("SELECT status, amount::text FROM "+schema+".transactions_entry WHERE hash = '0x03'").Scan(&status, &amount)
+	if err != nil {
+		t.Fatal(err)
+	} else if status != blockchain.ConfirmedStatus || amount != "255" {
+		t.Errorf("expected confirmed transaction with amount 255, got `%s` with %s", status, amount)
+	}
+
+	// New columns of upgraded tables are used
+	tx, err := blockchain.NewTransaction("aa", "cc", "0x5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.SetHash("0x05")
+	tx.SetStatus(blockchain.BroadcastStatus)
+	tx.FixateCreatedAt()
+	if err := st.SaveEntryTransaction(tx); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.SaveWithdrawTransaction(tx); err != nil {
+		t.Fatal(err)
+	}
+	if last, ok, err := st.LoadLastInChain("0x05"); err != nil || !ok || last.Hash() != "0x05" {
+		t.Errorf("transaction is not saved to upgraded database: %v", err)
+	}
+}
+
+// postgresTestConfig returns connection string and config of test database, test is skipped if it is not set
+func postgresTestConfig(t *testing.T) (string, *config.StorageConfig) {
+	dsn := os.Getenv(postgresDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", postgresDSNEnv)
+	}
+
+	c, err := postgresConfig(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dsn, c
+}
+
+// postgresConfig parses connection string of key=value pairs to config of storage
+func postgresConfig(dsn string) (*config.StorageConfig, error) {
+	c := &config.StorageConfig{Driver: storage.PostgresDriver, Port: 5432}
+	for _, pair := range strings.Fields(dsn) {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("wrong param `%s` of %s", pair, postgresDSNEnv)
+		}
+
+		switch kv[0] {
+		case "host":
+			c.IP = kv[1]
+		case "port":
+			port, err := strconv.Atoi(kv[1])
+			if err != nil {
+				return nil, fmt.Errorf("wrong port `%s` of %s", kv[1], postgresDSNEnv)
+			}
+			c.Port = port
+		case "user":
+			c.User = kv[1]
+		case "password":
+			c.Password = kv[1]
+		case "dbname":
+			c.DBName = kv[1]
+		default:
+			return nil, fmt.Errorf("unknown param `%s` of %s", kv[0], postgresDSNEnv)
+		}
+	}
+
+	return c, nil
+}
+
+func openDB(t *testing.T, dsn string) *sql.DB {
+	db, err := sql.Open(storage.PostgresDriver, dsn+" sslmode=disable")
+	if err != nil {
+		t.Fatalf("can't connect to test database: %v", err)
+	}
+
+	return db
+}
+
+func dropSchema(t *testing.T, dsn, schema string) {
+	db := openDB(t, dsn)
+	defer db.Close()
+
+	if _, err := db.Exec("DROP SCHEMA " + pq.QuoteIdentifier(schema) + " CASCADE"); err != nil {
+		t.Errorf("can't drop schema `%s`: %v", schema, err)
+	}
+}
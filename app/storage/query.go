@@ -1,28 +1,135 @@
 package storage
 
+// sendRequestColumns are columns of outbox, that are scanned to send request
+const sendRequestColumns = `id, request_id, client_id, COALESCE(idempotency_key, ''), COALESCE(payload_hash, ''), status, attempts, COALESCE(error, ''),
+    COALESCE(hash, ''), from_addr, to_addr, amount, COALESCE(token, ''), COALESCE(nonce, 0), COALESCE(gas, 0),
+    COALESCE(gas_price, '0x0'), COALESCE(max_fee_per_gas, '0x0'), COALESCE(max_priority_fee_per_gas, '0x0'), COALESCE(data, ''), COALESCE(raw, '')`
+
 const (
 	// UpsertBalanceSQL inserts new balance or updates if have balance with the same address
-	UpsertBalanceSQL = `INSERT INTO eth_client.eth_balance (address, balance) VALUES ($1, $2) ON CONFLICT (address) DO UPDATE SET balance = $2;`
+	UpsertBalanceSQL = `INSERT INTO eth_balance (address, balance) VALUES ($1, $2) ON CONFLICT (address) DO UPDATE SET balance = $2;`
 	// InsertEntryTransactionSQL inserts new entry transaction
-	InsertEntryTransactionSQL = `INSERT INTO eth_client.transactions_entry (hash, block_hash, block_number, from_addr, to_addr, created_at, amount, confirmations) VALUES ($1, $2, $3, $4, $5, $6, $7, 0) RETURNING id;`
+	InsertEntryTransactionSQL = `INSERT INTO transactions_entry (hash, block_hash, block_number, from_addr, to_addr, created_at, amount, token, status, confirmations) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, 0) RETURNING id;`
 	// InsertWithdrawTransactionSQL inserts new withdraw transaction
-	InsertWithdrawTransactionSQL = `INSERT INTO eth_client.transactions_withdraw (hash, from_addr, to_addr, amount, created_at) VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP);`
-	// SelectTransactionsByStatusSQL selects all transactions with some status
-	SelectTransactionsByStatusSQL = `SELECT id, hash, block_hash, block_number, from_addr, to_addr, confirmations, amount, status, created_at FROM eth_client.transactions_entry WHERE status = $1`
+	InsertWithdrawTransactionSQL = `INSERT INTO transactions_withdraw (hash, from_addr, to_addr, amount, token, gas, gas_price, max_fee_per_gas, max_priority_fee_per_gas, nonce, data, raw, replaces, original_hash, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, CURRENT_TIMESTAMP);`
+	// SelectLastInChainSQL selects the latest sent transaction of replacement chain, that contains transaction with some hash
+	SelectLastInChainSQL = `SELECT w.hash, w.from_addr, w.to_addr, w.amount, COALESCE(w.token, ''), w.nonce, w.gas, w.gas_price, w.max_fee_per_gas, w.max_priority_fee_per_gas, COALESCE(w.data, ''), COALESCE(w.raw, ''), COALESCE(w.original_hash, w.hash), e.status
+    FROM transactions_withdraw w JOIN transactions_entry e ON e.hash = w.hash
+    WHERE COALESCE(w.original_hash, w.hash) = (SELECT COALESCE(original_hash, hash) FROM transactions_withdraw WHERE hash = $1)
+    ORDER BY w.id DESC LIMIT 1`
+	// ResolveReplacementsSQL marks other unmined transactions of replacement chain as replaced and returns their previous statuses
+	ResolveReplacementsSQL = `UPDATE transactions_entry e SET status = $1 FROM (
+    SELECT id, status FROM transactions_entry WHERE status IN ($2, $3, $4) AND hash <> $5 AND hash IN (
+        SELECT hash FROM transactions_withdraw
+        WHERE COALESCE(original_hash, hash) = (SELECT COALESCE(original_hash, hash) FROM transactions_withdraw WHERE hash = $5)
+    ) FOR UPDATE
+) AS prev WHERE e.id = prev.id RETURNING e.hash, prev.status`
+	// SelectReplacementsCountSQL counts replacements in chain, that contains transaction with some hash
+	SelectReplacementsCountSQL = `SELECT COUNT(*) FROM transactions_withdraw
+    WHERE original_hash = (SELECT COALESCE(original_hash, hash) FROM transactions_withdraw WHERE hash = $1)`
+	// SelectActiveTransactionsSQL selects all transactions, that are sent, but not finished
+	SelectActiveTransactionsSQL = `SELECT id, hash, block_hash, block_number, from_addr, to_addr, confirmations, amount, COALESCE(token, ''), status, created_at FROM transactions_entry WHERE status IN ($1, $2, $3, $4)`
 	// SelectLastTransactionsSQL selects all transactions that are not showed and with confirmations less that some value
-	SelectLastTransactionsSQL = `SELECT id, hash, block_hash, block_number, from_addr, to_addr, confirmations, amount, status, created_at FROM eth_client.transactions_entry WHERE showed = FALSE OR confirmations < $1`
+	SelectLastTransactionsSQL = `SELECT id, hash, block_hash, block_number, from_addr, to_addr, confirmations, amount, COALESCE(token, ''), status, created_at FROM transactions_entry WHERE (showed = FALSE OR confirmations < $1) AND status <> $2`
 	// UpdateConfirmationsSQL update confirmation value for some entry transaction
-	UpdateConfirmationsSQL = `UPDATE eth_client.transactions_entry SET confirmations = $1 WHERE id = $2`
+	UpdateConfirmationsSQL = `UPDATE transactions_entry SET confirmations = $1 WHERE id = $2`
 	// UpdateTransactionStatusSQL update status for some entry transaction
-	UpdateTransactionStatusSQL = `UPDATE eth_client.transactions_entry SET status = $1 WHERE id = $2`
+	UpdateTransactionStatusSQL = `UPDATE transactions_entry SET status = $1 WHERE id = $2`
+	// UpdateTransactionReceiptSQL saves receipt values for some entry transaction
+	UpdateTransactionReceiptSQL = `UPDATE transactions_entry SET receipt_status = $1, gas_used = $2, effective_gas_price = $3, contract_address = $4 WHERE id = $5`
 	// UpdateTransactionsShowedSQL is batch updating of showed value
-	UpdateTransactionsShowedSQL = `UPDATE eth_client.transactions_entry SET showed = true WHERE id IN (%s)`
+	UpdateTransactionsShowedSQL = `UPDATE transactions_entry SET showed = true WHERE id IN (%s)`
+	// UpsertTokenBalanceSQL inserts new token balance or updates if have balance with the same address and token
+	UpsertTokenBalanceSQL = `INSERT INTO token_balance (address, token, balance) VALUES ($1, $2, $3) ON CONFLICT (address, token) DO UPDATE SET balance = $3;`
+	// LoadTokenBalances returns all addresses that used by app with their balances of some token
+	LoadTokenBalances = `SELECT a.address, b.balance FROM (
+    SELECT address FROM eth_balance
+    UNION SELECT from_addr FROM transactions_entry
+    UNION SELECT to_addr FROM transactions_entry
+) AS a
+LEFT JOIN (SELECT address, balance FROM token_balance WHERE token = $1) AS b
+ON a.address = b.address;`
+	// InsertWatchedAddressSQL adds address to watch-list if it is not there yet
+	InsertWatchedAddressSQL = `INSERT INTO watch_address (address, created_at) VALUES ($1, CURRENT_TIMESTAMP) ON CONFLICT (address) DO NOTHING;`
+	// SelectWatchedAddressesSQL selects addresses which incoming transactions are tracked
+	SelectWatchedAddressesSQL = `SELECT address FROM eth_balance UNION SELECT address FROM watch_address;`
+	// SelectTransactionExistsSQL checks that entry transaction with some hash is saved
+	SelectTransactionExistsSQL = `SELECT EXISTS (SELECT 1 FROM transactions_entry WHERE hash = $1);`
+	// SelectLastScannedBlockSQL selects number of last block that was checked for deposits
+	SelectLastScannedBlockSQL = `SELECT last_block FROM block_scanner WHERE id = 1;`
+	// UpsertLastScannedBlockSQL saves number of last block that was checked for deposits
+	UpsertLastScannedBlockSQL = `INSERT INTO block_scanner (id, last_block) VALUES (1, $1) ON CONFLICT (id) DO UPDATE SET last_block = $1;`
+	// UpsertHeaderSQL saves block header or replaces header with the same number
+	UpsertHeaderSQL = `INSERT INTO block_header (number, hash, parent_hash) VALUES ($1, $2, $3) ON CONFLICT (number) DO UPDATE SET hash = $2, parent_hash = $3;`
+	// SelectHeaderSQL selects block header by number
+	SelectHeaderSQL = `SELECT number, hash, parent_hash FROM block_header WHERE number = $1;`
+	// SelectLastHeaderNumberSQL selects number of the most recent saved header
+	SelectLastHeaderNumberSQL = `SELECT MAX(number) FROM block_header;`
+	// DeleteHeadersAfterSQL deletes headers of blocks after some number
+	DeleteHeadersAfterSQL = `DELETE FROM block_header WHERE number > $1;`
+	// DeleteHeadersBeforeSQL deletes headers of blocks before some number
+	DeleteHeadersBeforeSQL = `DELETE FROM block_header WHERE number < $1;`
+	// SelectTransactionsAfterBlockSQL selects transactions that are included in blocks after some number
+	SelectTransactionsAfterBlockSQL = `SELECT id, hash, block_hash, block_number, from_addr, to_addr, confirmations, amount, COALESCE(token, ''), status, created_at FROM transactions_entry WHERE block_number > $1`
+	// UpdateTransactionBlockSQL updates block of transaction and resets its confirmations and status
+	UpdateTransactionBlockSQL = `UPDATE transactions_entry SET block_hash = $1, block_number = $2, confirmations = 0, status = $3 WHERE id = $4`
+	// InsertSendRequestSQL adds accepted send request to outbox, request with used idempotency key of client is not added
+	InsertSendRequestSQL = `INSERT INTO send_outbox (request_id, client_id, idempotency_key, payload_hash, from_addr, to_addr, amount, token, data, status, attempts, created_at)
+    VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, 0, CURRENT_TIMESTAMP) ON CONFLICT (client_id, idempotency_key) DO NOTHING;`
+	// ClaimSendRequestSQL locks the oldest unfinished request of outbox, that is not locked by other worker, for some seconds
+	ClaimSendRequestSQL = `UPDATE send_outbox SET locked_until = CURRENT_TIMESTAMP + $1 * INTERVAL '1 second', attempts = attempts + 1
+    WHERE id = (
+        SELECT id FROM send_outbox
+        WHERE status IN ($2, $3) AND (locked_until IS NULL OR locked_until < CURRENT_TIMESTAMP)
+        ORDER BY id LIMIT 1 FOR UPDATE SKIP LOCKED
+    )
+    RETURNING ` + sendRequestColumns
+	// SelectUnsentRequestsCountSQL counts requests of outbox, that are not sent yet
+	SelectUnsentRequestsCountSQL = `SELECT COUNT(*) FROM send_outbox WHERE status IN ($1, $2)`
+	// SelectSendRequestByKeySQL selects send request by idempotency key of client
+	SelectSendRequestByKeySQL = `SELECT ` + sendRequestColumns + ` FROM send_outbox WHERE client_id = $1 AND idempotency_key = $2`
+	// SelectSendRequestsByStatusSQL selects requests of outbox with some status
+	SelectSendRequestsByStatusSQL = `SELECT ` + sendRequestColumns + ` FROM send_outbox WHERE status = $1 ORDER BY id`
+	// UpdateSendRequestSignedSQL saves signed transaction of request, so the same transaction is sent after restart
+	UpdateSendRequestSignedSQL = `UPDATE send_outbox SET status = $1, hash = $2, nonce = $3, gas = $4, gas_price = $5, max_fee_per_gas = $6, max_priority_fee_per_gas = $7, raw = $8 WHERE id = $9 AND status = $10`
+	// UpdateSendRequestStatusSQL finishes request of outbox and unlocks it
+	UpdateSendRequestStatusSQL = `UPDATE send_outbox SET status = $1, error = $2, locked_until = NULL WHERE id = $3`
+	// UpdateSendRequestErrorSQL saves error of last attempt to send request
+	UpdateSendRequestErrorSQL = `UPDATE send_outbox SET error = $1 WHERE id = $2`
+	// InsertTransitionSQL saves change of transaction status to history
+	InsertTransitionSQL = `INSERT INTO transaction_history (request_id, hash, from_status, to_status, created_at) VALUES ($1, $2, $3, $4, $5);`
+	// SelectHistorySQL selects history of transaction by its hash or ID of send request. Records of request
+	// before signing are joined with records of its transaction
+	SelectHistorySQL = `SELECT COALESCE(request_id, ''), COALESCE(hash, ''), COALESCE(from_status, ''), to_status, created_at FROM transaction_history
+    WHERE request_id = $1 OR hash = $1
+        OR hash IN (SELECT hash FROM transaction_history WHERE request_id = $1 AND hash IS NOT NULL)
+        OR request_id IN (SELECT request_id FROM transaction_history WHERE hash = $1 AND request_id IS NOT NULL)
+    ORDER BY created_at, id`
 	// LoadAllBalances returns all addresses that used by app with their balances
 	LoadAllBalances = `SELECT a.address, b.balance FROM (
-    SELECT address FROM eth_client.eth_balance
-    UNION SELECT from_addr FROM eth_client.transactions_entry
-    UNION SELECT to_addr FROM eth_client.transactions_entry
+    SELECT address FROM eth_balance
+    UNION SELECT from_addr FROM transactions_entry
+    UNION SELECT to_addr FROM transactions_entry
 ) AS a
-LEFT JOIN (SELECT address, balance FROM eth_client.eth_balance) AS b
+LEFT JOIN (SELECT address, balance FROM eth_balance) AS b
 ON a.address = b.address;`
+	// CreateSchemaSQL creates schema with some name in PostgreSQL, if it doesn't exist
+	CreateSchemaSQL = `CREATE SCHEMA IF NOT EXISTS %s`
+	// CreateMigrationsTableSQL creates table of applied migrations of schema
+	CreateMigrationsTableSQL = `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version bigint PRIMARY KEY,
+    name varchar(255) NOT NULL,
+    checksum varchar(64) NOT NULL,
+    applied_at timestamp NOT NULL
+)`
+	// SelectMigrationsSQL selects all applied migrations
+	SelectMigrationsSQL = `SELECT version, name, checksum, applied_at FROM schema_migrations ORDER BY version`
+	// SelectMigrationAppliedSQL checks that migration with some version is applied
+	SelectMigrationAppliedSQL = `SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)`
+	// InsertMigrationSQL saves applied migration
+	InsertMigrationSQL = `INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES ($1, $2, $3, $4)`
+	// DeleteMigrationSQL deletes reverted migration
+	DeleteMigrationSQL = `DELETE FROM schema_migrations WHERE version = $1`
+	// LockMigrationsSQL locks table of migrations in PostgreSQL till the end of transaction
+	LockMigrationsSQL = `LOCK TABLE schema_migrations IN EXCLUSIVE MODE`
 )
@@ -0,0 +1,513 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/kainobor/eth-client/app/blockchain"
+	"github.com/kainobor/eth-client/app/config"
+	"github.com/kainobor/eth-client/app/helper"
+)
+
+type (
+	// sqlStorage contains queries, that are the same for all SQL databases
+	sqlStorage struct {
+		config *config.StorageConfig
+		conn   *sql.DB
+		db     querier // Connection or transaction, that runs queries
+	}
+
+	// rowScanner is single row or current row of result
+	rowScanner interface {
+		Scan(dest ...interface{}) error
+	}
+
+	// querier runs queries on connection or in transaction
+	querier interface {
+		Exec(query string, args ...interface{}) (sql.Result, error)
+		Query(query string, args ...interface{}) (*sql.Rows, error)
+		QueryRow(query string, args ...interface{}) *sql.Row
+	}
+)
+
+// UpsertBalance inserts or updates balance by some address
+func (st *sqlStorage) UpsertBalance(addr string, balance *big.Int) error {
+	if _, err := st.db.Exec(UpsertBalanceSQL, strings.ToLower(addr), weiValue(*balance)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SaveWithdrawTransaction saves transaction as withdraw with gas values for cost accounting
+func (st *sqlStorage) SaveWithdrawTransaction(t *blockchain.Transaction) error {
+	_, err := st.db.Exec(
+		InsertWithdrawTransactionSQL,
+		t.Hash(),
+		t.From(),
+		t.Recipient(),
+		weiValue(t.Amount()),
+		nullString(t.Token()),
+		int64(t.Gas()),
+		helper.BigToHex(t.GasPrice()),
+		helper.BigToHex(t.MaxFeePerGas()),
+		helper.BigToHex(t.MaxPriorityFeePerGas()),
+		int64(t.Nonce()),
+		helper.BytesToHex(t.Data()),
+		helper.BytesToHex(t.Raw()),
+		nullString(t.Replaces()),
+		nullString(replacementOrigin(t)),
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// LoadLastInChain returns the latest sent transaction of replacement chain, that contains transaction with hash
+func (st *sqlStorage) LoadLastInChain(hash string) (*blockchain.Transaction, bool, error) {
+	dbw := new(blockchain.DBWithdraw)
+	err := st.db.QueryRow(SelectLastInChainSQL, hash).Scan(
+		&dbw.Hash,
+		&dbw.From,
+		&dbw.To,
+		scanWei(&dbw.Amount),
+		&dbw.Token,
+		&dbw.Nonce,
+		&dbw.Gas,
+		&dbw.GasPrice,
+		&dbw.MaxFee,
+		&dbw.MaxTip,
+		&dbw.Data,
+		&dbw.Raw,
+		&dbw.Origin,
+		&dbw.Status,
+	)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, fmt.Errorf("error while selecting sent transaction: %v", err)
+	}
+
+	t := new(blockchain.Transaction)
+	if err := t.FillFromWithdraw(dbw); err != nil {
+		return nil, false, err
+	}
+
+	return t, true, nil
+}
+
+// CountReplacements returns amount of replacements in chain, that contains transaction with hash
+func (st *sqlStorage) CountReplacements(hash string) (int, error) {
+	var count int
+	if err := st.db.QueryRow(SelectReplacementsCountSQL, hash).Scan(&count); err != nil {
+		return 0, fmt.Errorf("error while counting replacements: %v", err)
+	}
+
+	return count, nil
+}
+
+// replacementOrigin returns first transaction of replacement chain, empty for transaction without replacements
+func replacementOrigin(t *blockchain.Transaction) string {
+	if t.Replaces() == "" {
+		return ""
+	}
+
+	return t.Origin()
+}
+
+// UpdateConfirmations updates confirmations amount by ID and checks that row was updated
+func (st *sqlStorage) UpdateConfirmations(id, confirmations int64) error {
+	res, err := st.db.Exec(UpdateConfirmationsSQL, confirmations, id)
+	if err != nil {
+		return fmt.Errorf("error while executing confirmations updating: %v", err)
+	}
+
+	if affected, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("error while getting affected rows: %v", err)
+	} else if affected == 0 {
+		return fmt.Errorf("transaction #%d not updated", id)
+	}
+
+	return nil
+}
+
+// UpdateTransactionStatus updates status by ID and checks that row was updated
+func (st *sqlStorage) UpdateTransactionStatus(id int64, status string) error {
+	res, err := st.db.Exec(UpdateTransactionStatusSQL, status, id)
+	if err != nil {
+		return fmt.Errorf("error while executing status updating: %v", err)
+	}
+
+	if affected, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("error while getting affected rows: %v", err)
+	} else if affected == 0 {
+		return fmt.Errorf("transaction #%d not updated", id)
+	}
+
+	return nil
+}
+
+// SaveReceipt saves receipt values of transaction by ID and checks that row was updated
+func (st *sqlStorage) SaveReceipt(id int64, r *blockchain.Receipt) error {
+	res, err := st.db.Exec(
+		UpdateTransactionReceiptSQL,
+		r.Success(),
+		int64(r.GasUsed()),
+		helper.BigToHex(r.EffectiveGasPrice()),
+		nullString(r.ContractAddress()),
+		id,
+	)
+	if err != nil {
+		return fmt.Errorf("error while executing receipt updating: %v", err)
+	}
+
+	if affected, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("error while getting affected rows: %v", err)
+	} else if affected == 0 {
+		return fmt.Errorf("transaction #%d not updated", id)
+	}
+
+	return nil
+}
+
+// TransactionsShowed updates all transactions as showed page by page
+func (st *sqlStorage) TransactionsShowed(txs map[string]*blockchain.Transaction) error {
+	var ids []string
+	var i int
+	var rest = len(txs)
+	for _, tx := range txs {
+		i++
+		ids = append(ids, fmt.Sprintf("%d", tx.ID()))
+
+		if i < st.config.PageSize && i < rest {
+			continue
+		}
+
+		i = 0
+		rest = rest - st.config.PageSize
+		inCondition := strings.Join(ids, ",")
+		_, err := st.db.Exec(fmt.Sprintf(UpdateTransactionsShowedSQL, inCondition))
+		if err != nil {
+			return fmt.Errorf("error while setting transactions as showed: %v", err)
+		}
+
+		// clear slice
+		ids = ids[:0]
+	}
+
+	return nil
+}
+
+// LoadActiveTransactions returns all transactions, that are sent, but not finished
+func (st *sqlStorage) LoadActiveTransactions() (map[string]*blockchain.Transaction, error) {
+	args := make([]interface{}, len(blockchain.ActiveStatuses))
+	for i, status := range blockchain.ActiveStatuses {
+		args[i] = status
+	}
+
+	return st.loadTransactions(SelectActiveTransactionsSQL, args...)
+}
+
+// LoadLastTransactions returns all not shown transactions
+// with amount of confirmations less than some value
+func (st *sqlStorage) LoadLastTransactions(lastConfirmations int64) (map[string]*blockchain.Transaction, error) {
+	// Replaced transactions are never mined, so they are not shown
+	return st.loadTransactions(SelectLastTransactionsSQL, lastConfirmations, blockchain.ReplacedStatus)
+}
+
+// Close DB connection
+func (st *sqlStorage) Close() error {
+	if err := st.conn.Close(); err != nil {
+		return fmt.Errorf("storage closing error: %v", err)
+	}
+
+	return nil
+}
+
+// transaction runs fn with copy of storage, that works in SQL transaction. Transaction is committed
+// if fn returns nil. Storage, that already works in transaction, runs fn in the same transaction
+func (st *sqlStorage) transaction(fn func(tx *sqlStorage) error) error {
+	if _, ok := st.db.(*sql.Tx); ok {
+		return fn(st)
+	}
+
+	tx, err := st.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("error while beginning transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(&sqlStorage{config: st.config, conn: st.conn, db: tx}); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error while committing transaction: %v", err)
+	}
+
+	return nil
+}
+
+func (st *sqlStorage) loadTransactions(query string, args ...interface{}) (map[string]*blockchain.Transaction, error) {
+	txs := make(map[string]*blockchain.Transaction)
+
+	rows, err := st.db.Query(query, args...)
+	if err != nil {
+		return txs, fmt.Errorf("error while selecting transactions: %v", err)
+	}
+
+	for rows.Next() {
+		var dbTx = new(blockchain.DBTransaction)
+		err = rows.Scan(&dbTx.ID, &dbTx.Hash, &dbTx.BlockHash, &dbTx.BlockNumber, &dbTx.From, &dbTx.To, &dbTx.Confirmations, scanWei(&dbTx.Amount), &dbTx.Token, &dbTx.Status, &dbTx.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("error while scanning transaction: %v", err)
+		}
+
+		tx := new(blockchain.Transaction)
+		if err := tx.FillFromDB(dbTx); err != nil {
+			return nil, fmt.Errorf("error while filling transaction: %v", tx)
+		}
+
+		txs[tx.Hash()] = tx
+	}
+
+	return txs, nil
+}
+
+// UpsertTokenBalance inserts or updates balance of token by some address
+func (st *sqlStorage) UpsertTokenBalance(addr, token string, balance *big.Int) error {
+	if _, err := st.db.Exec(UpsertTokenBalanceSQL, strings.ToLower(addr), strings.ToLower(token), weiValue(*balance)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// AddWatchedAddress adds address to watch-list of incoming transactions
+func (st *sqlStorage) AddWatchedAddress(addr string) error {
+	if _, err := st.db.Exec(InsertWatchedAddressSQL, strings.ToLower(addr)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// LoadWatchedAddresses returns set of addresses with known balances or from watch-list
+func (st *sqlStorage) LoadWatchedAddresses() (map[string]bool, error) {
+	addrs := make(map[string]bool)
+
+	rows, err := st.db.Query(SelectWatchedAddressesSQL)
+	if err != nil {
+		return addrs, fmt.Errorf("error while selecting watched addresses: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var addr string
+		if err := rows.Scan(&addr); err != nil {
+			return addrs, fmt.Errorf("error while scanning address: %v", err)
+		}
+
+		addrs[strings.ToLower(helper.TrimHexPrefix(addr))] = true
+	}
+
+	return addrs, nil
+}
+
+// TransactionExists checks that entry transaction with hash is saved
+func (st *sqlStorage) TransactionExists(hash string) (bool, error) {
+	var exists bool
+	if err := st.db.QueryRow(SelectTransactionExistsSQL, hash).Scan(&exists); err != nil {
+		return false, fmt.Errorf("error while checking transaction: %v", err)
+	}
+
+	return exists, nil
+}
+
+// LoadLastScannedBlock returns number of last block that was checked for deposits,
+// false is returned if scanning was never done
+func (st *sqlStorage) LoadLastScannedBlock() (int64, bool, error) {
+	var lastBlock int64
+	err := st.db.QueryRow(SelectLastScannedBlockSQL).Scan(&lastBlock)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	} else if err != nil {
+		return 0, false, fmt.Errorf("error while selecting last scanned block: %v", err)
+	}
+
+	return lastBlock, true, nil
+}
+
+// SaveLastScannedBlock saves number of last block that was checked for deposits
+func (st *sqlStorage) SaveLastScannedBlock(blockNumber int64) error {
+	if _, err := st.db.Exec(UpsertLastScannedBlockSQL, blockNumber); err != nil {
+		return fmt.Errorf("error while saving last scanned block: %v", err)
+	}
+
+	return nil
+}
+
+// SaveHeader saves header of block, header with the same number is replaced
+func (st *sqlStorage) SaveHeader(h *blockchain.Header) error {
+	number := h.Number()
+	if _, err := st.db.Exec(UpsertHeaderSQL, number.Int64(), h.Hash(), h.ParentHash()); err != nil {
+		return fmt.Errorf("error while saving header: %v", err)
+	}
+
+	return nil
+}
+
+// LoadHeader returns saved header of block with some number, false is returned if it is not saved
+func (st *sqlStorage) LoadHeader(number int64) (*blockchain.Header, bool, error) {
+	var num int64
+	var hash, parentHash string
+	err := st.db.QueryRow(SelectHeaderSQL, number).Scan(&num, &hash, &parentHash)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, fmt.Errorf("error while selecting header: %v", err)
+	}
+
+	return blockchain.NewHeader(*big.NewInt(num), hash, parentHash), true, nil
+}
+
+// LoadLastHeaderNumber returns number of the most recent saved header, false is returned if there are no headers
+func (st *sqlStorage) LoadLastHeaderNumber() (int64, bool, error) {
+	var number sql.NullInt64
+	if err := st.db.QueryRow(SelectLastHeaderNumberSQL).Scan(&number); err != nil {
+		return 0, false, fmt.Errorf("error while selecting last header: %v", err)
+	}
+
+	return number.Int64, number.Valid, nil
+}
+
+// DeleteHeadersAfter deletes headers of blocks after some number
+func (st *sqlStorage) DeleteHeadersAfter(number int64) error {
+	if _, err := st.db.Exec(DeleteHeadersAfterSQL, number); err != nil {
+		return fmt.Errorf("error while deleting headers: %v", err)
+	}
+
+	return nil
+}
+
+// PruneHeaders deletes headers of blocks before some number
+func (st *sqlStorage) PruneHeaders(number int64) error {
+	if _, err := st.db.Exec(DeleteHeadersBeforeSQL, number); err != nil {
+		return fmt.Errorf("error while pruning headers: %v", err)
+	}
+
+	return nil
+}
+
+// LoadTransactionsAfterBlock returns all transactions included in blocks after some number
+func (st *sqlStorage) LoadTransactionsAfterBlock(number int64) (map[string]*blockchain.Transaction, error) {
+	return st.loadTransactions(SelectTransactionsAfterBlockSQL, number)
+}
+
+// UpdateTransactionBlock saves block of transaction with reset confirmations and status
+func (st *sqlStorage) UpdateTransactionBlock(t *blockchain.Transaction) error {
+	blockNum := t.BlockNumber()
+	res, err := st.db.Exec(UpdateTransactionBlockSQL, t.BlockHash(), (&blockNum).Int64(), t.Status(), t.ID())
+	if err != nil {
+		return fmt.Errorf("error while executing block updating: %v", err)
+	}
+
+	if affected, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("error while getting affected rows: %v", err)
+	} else if affected == 0 {
+		return fmt.Errorf("transaction #%d not updated", t.ID())
+	}
+
+	return nil
+}
+
+// LoadAllBalances returns map with all balances
+func (st *sqlStorage) LoadAllBalances() (map[string]*big.Int, error) {
+	return st.loadBalances(LoadAllBalances)
+}
+
+// LoadTokenBalances returns map with balances of token for all addresses
+func (st *sqlStorage) LoadTokenBalances(token string) (map[string]*big.Int, error) {
+	return st.loadBalances(LoadTokenBalances, strings.ToLower(token))
+}
+
+func (st *sqlStorage) loadBalances(query string, args ...interface{}) (map[string]*big.Int, error) {
+	balMap := make(map[string]*big.Int)
+
+	rows, err := st.db.Query(query, args...)
+	if err != nil {
+		return balMap, fmt.Errorf("error while selecting all balances: %v", err)
+	}
+
+	for rows.Next() {
+		var addr *string
+		var bal *big.Int
+		err = rows.Scan(&addr, scanWei(&bal))
+		if err != nil {
+			return balMap, fmt.Errorf("error while scanning balance: %v", err)
+		}
+
+		// Address without saved balance has zero balance
+		if bal == nil {
+			bal = big.NewInt(0)
+		}
+
+		balMap[*addr] = bal
+	}
+
+	return balMap, nil
+}
+
+// nullString converts empty string to NULL
+func nullString(s string) *string {
+	if s == "" {
+		return nil
+	}
+
+	return &s
+}
+
+// weiScanner scans amount, that is saved as decimal number of wei, NULL is scanned as nil
+type weiScanner struct {
+	dst **big.Int
+}
+
+// scanWei returns scanner of amount to dst
+func scanWei(dst **big.Int) *weiScanner {
+	return &weiScanner{dst: dst}
+}
+
+// Scan implements sql.Scanner. Numbers come as text from PostgreSQL and SQLite, small ones can come as integers
+func (s *weiScanner) Scan(src interface{}) error {
+	var str string
+	switch v := src.(type) {
+	case nil:
+		*s.dst = nil
+		return nil
+	case int64:
+		*s.dst = big.NewInt(v)
+		return nil
+	case []byte:
+		str = string(v)
+	case string:
+		str = v
+	default:
+		return fmt.Errorf("can't scan amount from %T", src)
+	}
+
+	amount, ok := new(big.Int).SetString(str, 10)
+	if !ok {
+		return fmt.Errorf("can't parse amount `%s` from DB", str)
+	}
+	*s.dst = amount
+
+	return nil
+}
+
+// weiValue converts amount to decimal number for saving to NUMERIC column
+func weiValue(amount big.Int) string {
+	return amount.String()
+}
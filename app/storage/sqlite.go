@@ -0,0 +1,227 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/kainobor/eth-client/app/blockchain"
+	"github.com/kainobor/eth-client/app/config"
+	"github.com/kainobor/eth-client/app/helper"
+	"github.com/mattn/go-sqlite3"
+)
+
+type (
+	// SQLite is storage in local file of SQLite database, so application runs without database server.
+	// Queries are the same as for PostgreSQL, SQLite understands numbered parameters like $1 too
+	SQLite struct {
+		sqlStorage
+	}
+)
+
+var _ Storage = (*SQLite)(nil)
+
+const (
+	// sqliteBusyTimeout is time in milliseconds, that query waits for lock of database file, taken by other process
+	sqliteBusyTimeout = 5000
+	// sqliteDriverName is name of SQLite driver with functions, that are used by migrations
+	sqliteDriverName = "sqlite3_eth_client"
+)
+
+func init() {
+	sql.Register(sqliteDriverName, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			if err := conn.RegisterFunc("hex_to_decimal", hexToDecimal, true); err != nil {
+				return err
+			}
+			return conn.RegisterFunc("decimal_to_hex", decimalToHex, true)
+		},
+	})
+}
+
+// NewSQLite is constructor for storage in SQLite
+func NewSQLite(config *config.StorageConfig) *SQLite {
+	return &SQLite{sqlStorage{config: config}}
+}
+
+// Connect opens database file and applies migrations, that are not applied yet
+func (st *SQLite) Connect() error {
+	if err := st.open(); err != nil {
+		return err
+	}
+
+	m, err := st.migrator()
+	if err != nil {
+		return err
+	}
+	if _, err := m.Up(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// open opens database file, it is created if it doesn't exist
+func (st *SQLite) open() error {
+	var err error
+	if st.conn, err = sql.Open(sqliteDriverName, sqliteConnectString(st.config)); err != nil {
+		return fmt.Errorf("storage connectiong error: %v", err)
+	}
+	st.db = st.conn
+	// SQLite has one writer anyway, and with one connection queries wait for each other instead of failing on lock
+	st.conn.SetMaxOpenConns(1)
+
+	if err = st.conn.Ping(); err != nil {
+		return fmt.Errorf("storage is not responding: %v", err)
+	}
+
+	return nil
+}
+
+// migrator of SQLite doesn't lock table of migrations, because transaction of writer locks the whole database
+func (st *SQLite) migrator() (*Migrator, error) {
+	return newMigrator(st.conn, SQLiteDriver, "")
+}
+
+// WithTx runs fn with storage, that works in transaction. Changes are committed if fn returns nil.
+// Transaction holds the only connection, so fn must not use other storage
+func (st *SQLite) WithTx(fn func(tx Storage) error) error {
+	return st.transaction(func(tx *sqlStorage) error {
+		return fn(&SQLite{*tx})
+	})
+}
+
+// SaveEntryTransaction inserts entry transaction to DB and renews transaction ID
+func (st *SQLite) SaveEntryTransaction(t *blockchain.Transaction) error {
+	blockNum := t.BlockNumber()
+	res, err := st.db.Exec(
+		SQLiteInsertEntryTransactionSQL,
+		t.Hash(),
+		t.BlockHash(),
+		(&blockNum).Int64(),
+		t.From(),
+		t.Recipient(),
+		t.CreatedAt(),
+		weiValue(t.Amount()),
+		nullString(t.Token()),
+		t.Status(),
+	)
+	if err != nil {
+		return fmt.Errorf("transaction `%s` not inserted: %v", t.Hash(), err)
+	}
+
+	insertedID, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("error while getting ID of transaction `%s`: %v", t.Hash(), err)
+	}
+	t.SetID(insertedID)
+
+	return nil
+}
+
+// ResolveReplacements marks other unmined transactions of replacement chain of mined transaction
+// as replaced and returns their previous statuses by hashes
+func (st *SQLite) ResolveReplacements(minedHash string) (map[string]string, error) {
+	replaced := make(map[string]string)
+	err := st.transaction(func(tx *sqlStorage) error {
+		rows, err := tx.db.Query(
+			SQLiteSelectReplacementsSQL,
+			blockchain.BroadcastStatus,
+			blockchain.ReorgedStatus,
+			blockchain.DroppedStatus,
+			minedHash,
+		)
+		if err != nil {
+			return fmt.Errorf("error while selecting replacements: %v", err)
+		}
+
+		for rows.Next() {
+			var hash, status string
+			if err := rows.Scan(&hash, &status); err != nil {
+				rows.Close()
+				return fmt.Errorf("error while scanning replaced transaction: %v", err)
+			}
+			replaced[hash] = status
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error while selecting replacements: %v", err)
+		}
+
+		for hash := range replaced {
+			if _, err := tx.db.Exec(SQLiteUpdateReplacedSQL, blockchain.ReplacedStatus, hash); err != nil {
+				return fmt.Errorf("error while marking transaction `%s` as replaced: %v", hash, err)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error while resolving replacements: %v", err)
+	}
+
+	return replaced, nil
+}
+
+// ClaimSendRequest locks the oldest unfinished request of outbox for lease time, so other workers skip it.
+// Request, that was not finished before lease expired, is claimed again
+func (st *SQLite) ClaimSendRequest(lease time.Duration) (*SendRequest, bool, error) {
+	var (
+		req *SendRequest
+		ok  bool
+	)
+	err := st.transaction(func(tx *sqlStorage) error {
+		// Times are compared as strings, so all of them are in UTC
+		now := time.Now().UTC()
+		var id int64
+		err := tx.db.QueryRow(SQLiteSelectClaimableRequestSQL, blockchain.QueuedStatus, blockchain.SignedStatus, now).Scan(&id)
+		if err == sql.ErrNoRows {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if _, err := tx.db.Exec(SQLiteLockSendRequestSQL, now.Add(lease), id); err != nil {
+			return fmt.Errorf("error while locking send request: %v", err)
+		}
+
+		req, ok, err = scanSendRequest(tx.db.QueryRow(SQLiteSelectSendRequestSQL, id))
+		return err
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("error while claiming send request: %v", err)
+	}
+
+	return req, ok, nil
+}
+
+func sqliteConnectString(config *config.StorageConfig) string {
+	file := config.File
+	if file == "" {
+		// Each network has own file as it has own schema in PostgreSQL
+		file = schemaName(config) + ".db"
+	}
+
+	return fmt.Sprintf("file:%s?_busy_timeout=%d", file, sqliteBusyTimeout)
+}
+
+// hexToDecimal converts hex number like 0x1f to decimal one, it is used by migration of amounts
+func hexToDecimal(hex string) (string, error) {
+	num, ok := helper.HexToBig(hex)
+	if !ok {
+		return "", fmt.Errorf("wrong hex number `%s`", hex)
+	}
+
+	return num.String(), nil
+}
+
+// decimalToHex converts decimal number back to hex one
+func decimalToHex(decimal string) (string, error) {
+	num, ok := new(big.Int).SetString(decimal, 10)
+	if !ok {
+		return "", fmt.Errorf("wrong decimal number `%s`", decimal)
+	}
+
+	return helper.BigToHex(*num), nil
+}
@@ -0,0 +1,23 @@
+package storage
+
+// Queries of SQLite, that differ from PostgreSQL ones. SQLite doesn't lock rows and doesn't have
+// UPDATE ... RETURNING in all versions, so these operations are made by several queries in transaction
+const (
+	// SQLiteInsertEntryTransactionSQL inserts new entry transaction, its ID is got from result
+	SQLiteInsertEntryTransactionSQL = `INSERT INTO transactions_entry (hash, block_hash, block_number, from_addr, to_addr, created_at, amount, token, status, confirmations) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, 0);`
+	// SQLiteSelectReplacementsSQL selects other unmined transactions of replacement chain with their statuses
+	SQLiteSelectReplacementsSQL = `SELECT hash, status FROM transactions_entry WHERE status IN ($1, $2, $3) AND hash <> $4 AND hash IN (
+    SELECT hash FROM transactions_withdraw
+    WHERE COALESCE(original_hash, hash) = (SELECT COALESCE(original_hash, hash) FROM transactions_withdraw WHERE hash = $4)
+)`
+	// SQLiteUpdateReplacedSQL marks transaction as replaced
+	SQLiteUpdateReplacedSQL = `UPDATE transactions_entry SET status = $1 WHERE hash = $2`
+	// SQLiteSelectClaimableRequestSQL selects the oldest unfinished request of outbox, that is not locked
+	SQLiteSelectClaimableRequestSQL = `SELECT id FROM send_outbox
+    WHERE status IN ($1, $2) AND (locked_until IS NULL OR locked_until < $3)
+    ORDER BY id LIMIT 1`
+	// SQLiteLockSendRequestSQL locks request of outbox till some time
+	SQLiteLockSendRequestSQL = `UPDATE send_outbox SET locked_until = $1, attempts = attempts + 1 WHERE id = $2`
+	// SQLiteSelectSendRequestSQL selects send request by ID
+	SQLiteSelectSendRequestSQL = `SELECT ` + sendRequestColumns + ` FROM send_outbox WHERE id = $1`
+)
@@ -0,0 +1,25 @@
+package storage_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/kainobor/eth-client/app/config"
+	"github.com/kainobor/eth-client/app/storage"
+	"github.com/kainobor/eth-client/app/storage/storagetest"
+)
+
+func TestSQLite(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		st := storage.NewSQLite(&config.StorageConfig{
+			Driver: storage.SQLiteDriver,
+			File:   filepath.Join(t.TempDir(), "storage.db"),
+		})
+		if err := st.Connect(); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { st.Close() })
+
+		return st
+	})
+}
@@ -0,0 +1,433 @@
+// Package storagetest contains conformance tests, that every implementation of storage must pass
+package storagetest
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/kainobor/eth-client/app/blockchain"
+	"github.com/kainobor/eth-client/app/helper"
+	"github.com/kainobor/eth-client/app/storage"
+)
+
+const (
+	// maxAmount is the biggest amount of wei, 2^256 - 1
+	maxAmount = "0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff"
+
+	addrA = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	addrB = "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+	token = "cccccccccccccccccccccccccccccccccccccccc"
+)
+
+// Run runs all tests against storages, that are created by newStorage. Every test gets empty storage
+func Run(t *testing.T, newStorage func(t *testing.T) storage.Storage) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, st storage.Storage)
+	}{
+		{"Balances", testBalances},
+		{"Transactions", testTransactions},
+		{"Replacements", testReplacements},
+		{"Scanning", testScanning},
+		{"Headers", testHeaders},
+		{"Outbox", testOutbox},
+		{"History", testHistory},
+		{"Tx", testTx},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			test.run(t, newStorage(t))
+		})
+	}
+}
+
+func testBalances(t *testing.T, st storage.Storage) {
+	must(t, st.UpsertBalance(addrA, big.NewInt(0x10)))
+	must(t, st.UpsertBalance(addrA, big.NewInt(0x20)))
+	must(t, st.UpsertTokenBalance(addrA, token, big.NewInt(5)))
+	saveEntry(t, st, newTransaction(t, addrA, addrB, "0x1"), "0x01", blockchain.BroadcastStatus)
+
+	balances, err := st.LoadAllBalances()
+	must(t, err)
+	checkBalance(t, balances, addrA, 0x20)
+	checkBalance(t, balances, addrB, 0)
+
+	max, _ := helper.HexToBig(maxAmount)
+	must(t, st.UpsertBalance(addrB, max))
+	balances, err = st.LoadAllBalances()
+	must(t, err)
+	if bal := balances[addrB]; bal == nil || bal.Cmp(max) != 0 {
+		t.Errorf("expected balance %s of `%s`, got %s", max, addrB, bal)
+	}
+
+	balances, err = st.LoadTokenBalances(token)
+	must(t, err)
+	checkBalance(t, balances, addrA, 5)
+	checkBalance(t, balances, addrB, 0)
+}
+
+func testTransactions(t *testing.T, st storage.Storage) {
+	tx := newTransaction(t, addrA, addrB, maxAmount)
+	saveEntry(t, st, tx, "0x01", blockchain.BroadcastStatus)
+	if tx.ID() == 0 {
+		t.Fatal("ID of saved transaction is not set")
+	}
+
+	exists, err := st.TransactionExists("0x01")
+	must(t, err)
+	if !exists {
+		t.Error("saved transaction is not found")
+	}
+	exists, err = st.TransactionExists("0x02")
+	must(t, err)
+	if exists {
+		t.Error("unknown transaction is found")
+	}
+
+	active, err := st.LoadActiveTransactions()
+	must(t, err)
+	loaded, ok := active["0x01"]
+	if !ok {
+		t.Fatal("broadcast transaction is not active")
+	}
+	amount, savedAmount := loaded.Amount(), tx.Amount()
+	if loaded.ID() != tx.ID() || loaded.From() != addrA || loaded.Recipient() != addrB || loaded.Status() != blockchain.BroadcastStatus ||
+		amount.Cmp(&savedAmount) != 0 {
+		t.Errorf("loaded transaction %+v differs from saved %+v", loaded, tx)
+	}
+
+	mined := minedTransaction(t, tx.ID(), "0x01", 10)
+	must(t, st.UpdateTransactionBlock(mined))
+	after, err := st.LoadTransactionsAfterBlock(9)
+	must(t, err)
+	if _, ok := after["0x01"]; !ok {
+		t.Error("mined transaction is not loaded after previous block")
+	}
+	after, err = st.LoadTransactionsAfterBlock(10)
+	must(t, err)
+	if len(after) != 0 {
+		t.Errorf("transactions are loaded after their block: %v", after)
+	}
+
+	must(t, st.UpdateConfirmations(tx.ID(), 3))
+	must(t, st.UpdateTransactionStatus(tx.ID(), blockchain.ConfirmedStatus))
+	active, err = st.LoadActiveTransactions()
+	must(t, err)
+	if len(active) != 0 {
+		t.Errorf("confirmed transaction is active: %v", active)
+	}
+
+	last, err := st.LoadLastTransactions(5)
+	must(t, err)
+	if _, ok := last["0x01"]; !ok {
+		t.Error("not showed transaction is not loaded as last")
+	}
+	must(t, st.TransactionsShowed(last))
+	last, err = st.LoadLastTransactions(3)
+	must(t, err)
+	if len(last) != 0 {
+		t.Errorf("showed transaction with enough confirmations is loaded as last: %v", last)
+	}
+
+	if err := st.UpdateTransactionStatus(tx.ID()+100, blockchain.ConfirmedStatus); err == nil {
+		t.Error("updating of unknown transaction doesn't fail")
+	}
+	if err := st.UpdateConfirmations(tx.ID()+100, 1); err == nil {
+		t.Error("updating of unknown transaction doesn't fail")
+	}
+}
+
+func testReplacements(t *testing.T, st storage.Storage) {
+	first := newTransaction(t, addrA, addrB, "0x1")
+	first.SetHash("0x01")
+	second := blockchain.NewReplacement(first)
+	second.SetReplaced(first)
+	second.SetHash("0x02")
+	third := blockchain.NewReplacement(second)
+	third.SetReplaced(second)
+	third.SetHash("0x03")
+
+	for _, tx := range []*blockchain.Transaction{first, second, third} {
+		must(t, st.SaveWithdrawTransaction(tx))
+		saveEntry(t, st, tx, tx.Hash(), blockchain.BroadcastStatus)
+	}
+
+	count, err := st.CountReplacements("0x01")
+	must(t, err)
+	if count != 2 {
+		t.Errorf("expected 2 replacements, got %d", count)
+	}
+
+	last, ok, err := st.LoadLastInChain("0x01")
+	must(t, err)
+	if !ok || last.Hash() != "0x03" || last.Origin() != "0x01" {
+		t.Errorf("expected the last transaction of chain, got %+v", last)
+	}
+	if _, ok, err := st.LoadLastInChain("0x04"); err != nil || ok {
+		t.Errorf("unknown chain is loaded: %v, %v", ok, err)
+	}
+
+	must(t, st.UpdateTransactionStatus(second.ID(), blockchain.DroppedStatus))
+	replaced, err := st.ResolveReplacements("0x03")
+	must(t, err)
+	if len(replaced) != 2 || replaced["0x01"] != blockchain.BroadcastStatus || replaced["0x02"] != blockchain.DroppedStatus {
+		t.Errorf("unexpected replaced transactions: %v", replaced)
+	}
+
+	active, err := st.LoadActiveTransactions()
+	must(t, err)
+	if len(active) != 1 || active["0x03"] == nil {
+		t.Errorf("only mined transaction of chain must be active, got %v", active)
+	}
+}
+
+func testScanning(t *testing.T, st storage.Storage) {
+	if _, ok, err := st.LoadLastScannedBlock(); err != nil || ok {
+		t.Errorf("last scanned block is loaded before scanning: %v, %v", ok, err)
+	}
+	must(t, st.SaveLastScannedBlock(5))
+	must(t, st.SaveLastScannedBlock(7))
+	number, ok, err := st.LoadLastScannedBlock()
+	must(t, err)
+	if !ok || number != 7 {
+		t.Errorf("expected last scanned block 7, got %d", number)
+	}
+
+	must(t, st.UpsertBalance(addrA, big.NewInt(0)))
+	must(t, st.AddWatchedAddress("0x"+addrB))
+	must(t, st.AddWatchedAddress("0x"+addrB))
+	addrs, err := st.LoadWatchedAddresses()
+	must(t, err)
+	if len(addrs) != 2 || !addrs[addrA] || !addrs[addrB] {
+		t.Errorf("unexpected watched addresses: %v", addrs)
+	}
+}
+
+func testHeaders(t *testing.T, st storage.Storage) {
+	if _, ok, err := st.LoadLastHeaderNumber(); err != nil || ok {
+		t.Errorf("last header is loaded from empty storage: %v, %v", ok, err)
+	}
+
+	for i := int64(1); i <= 5; i++ {
+		must(t, st.SaveHeader(blockchain.NewHeader(*big.NewInt(i), "0xa", "0xb")))
+	}
+	must(t, st.SaveHeader(blockchain.NewHeader(*big.NewInt(3), "0xc", "0xd")))
+
+	h, ok, err := st.LoadHeader(3)
+	must(t, err)
+	if !ok || h.Hash() != "0xc" || h.ParentHash() != "0xd" {
+		t.Errorf("saved header is not replaced: %+v", h)
+	}
+
+	must(t, st.DeleteHeadersAfter(4))
+	must(t, st.PruneHeaders(2))
+	number, ok, err := st.LoadLastHeaderNumber()
+	must(t, err)
+	if !ok || number != 4 {
+		t.Errorf("expected last header 4, got %d", number)
+	}
+	if _, ok, err := st.LoadHeader(1); err != nil || ok {
+		t.Errorf("pruned header is loaded: %v, %v", ok, err)
+	}
+}
+
+func testOutbox(t *testing.T, st storage.Storage) {
+	first := &storage.SendRequest{RequestID: "r1", ClientID: "c", IdempotencyKey: "k", PayloadHash: "p", Transaction: newTransaction(t, addrA, addrB, "0x1")}
+	added, err := st.AddSendRequest(first)
+	must(t, err)
+	if !added || first.Status != blockchain.QueuedStatus {
+		t.Fatalf("request is not added: %+v", first)
+	}
+
+	dup := &storage.SendRequest{RequestID: "r2", ClientID: "c", IdempotencyKey: "k", PayloadHash: "p", Transaction: newTransaction(t, addrA, addrB, "0x1")}
+	added, err = st.AddSendRequest(dup)
+	must(t, err)
+	if added {
+		t.Error("request with used idempotency key is added")
+	}
+	other := &storage.SendRequest{RequestID: "r3", ClientID: "d", IdempotencyKey: "k", Transaction: newTransaction(t, addrA, addrB, "0x2")}
+	added, err = st.AddSendRequest(other)
+	must(t, err)
+	if !added {
+		t.Error("idempotency key of other client is not available")
+	}
+
+	found, ok, err := st.LoadSendRequestByKey("c", "k")
+	must(t, err)
+	if !ok || found.RequestID != "r1" || found.PayloadHash != "p" || found.Transaction.Recipient() != addrB {
+		t.Errorf("unexpected request by key: %+v", found)
+	}
+
+	count, err := st.CountUnsentRequests()
+	must(t, err)
+	if count != 2 {
+		t.Errorf("expected 2 unsent requests, got %d", count)
+	}
+
+	claimed, ok, err := st.ClaimSendRequest(time.Minute)
+	must(t, err)
+	if !ok || claimed.RequestID != "r1" || claimed.Attempts != 1 || claimed.Transaction.Status() != blockchain.QueuedStatus {
+		t.Fatalf("the oldest request is not claimed: %+v", claimed)
+	}
+	claimed2, ok, err := st.ClaimSendRequest(time.Minute)
+	must(t, err)
+	if !ok || claimed2.RequestID != "r3" {
+		t.Fatalf("locked request is claimed again: %+v", claimed2)
+	}
+	if _, ok, err := st.ClaimSendRequest(time.Minute); err != nil || ok {
+		t.Errorf("locked requests are claimed: %v, %v", ok, err)
+	}
+
+	tx := claimed.Transaction
+	tx.SetHash("0x01")
+	tx.SetNonce(7)
+	tx.SetGas(21000)
+	tx.SetGasPrice(*big.NewInt(100))
+	tx.SetRaw([]byte{1, 2, 3})
+	must(t, st.SaveSignedRequest(claimed.ID, tx))
+	if err := st.SaveSignedRequest(claimed.ID, tx); err == nil {
+		t.Error("request is signed twice")
+	}
+
+	must(t, st.SaveSendRequestError(claimed2.ID, "failed"))
+	must(t, st.FinishSendRequest(claimed2.ID, blockchain.DroppedStatus, "failed"))
+
+	found, ok, err = st.LoadSendRequestByKey("c", "k")
+	must(t, err)
+	signed := found.Transaction
+	if !ok || found.Status != blockchain.SignedStatus || signed.Hash() != "0x01" || signed.Nonce() != 7 || signed.Gas() != 21000 || len(signed.Raw()) != 3 {
+		t.Errorf("signed transaction of request is not saved: %+v", found)
+	}
+
+	count, err = st.CountUnsentRequests()
+	must(t, err)
+	if count != 1 {
+		t.Errorf("expected 1 unsent request, got %d", count)
+	}
+
+	signedReqs, err := st.LoadSignedRequests()
+	must(t, err)
+	if len(signedReqs) != 1 || signedReqs[0].RequestID != "r1" || signedReqs[0].Transaction.Nonce() != 7 {
+		t.Errorf("unexpected signed requests: %+v", signedReqs)
+	}
+}
+
+func testHistory(t *testing.T, st storage.Storage) {
+	now := time.Now().UTC().Truncate(time.Second)
+	records := []*blockchain.Transition{
+		{RequestID: "r1", ToStatus: blockchain.QueuedStatus, CreatedAt: now},
+		{RequestID: "r1", Hash: "0x01", FromStatus: blockchain.QueuedStatus, ToStatus: blockchain.SignedStatus, CreatedAt: now.Add(time.Second)},
+		{RequestID: "r1", Hash: "0x01", FromStatus: blockchain.SignedStatus, ToStatus: blockchain.BroadcastStatus, CreatedAt: now.Add(2 * time.Second)},
+		{Hash: "0x01", FromStatus: blockchain.BroadcastStatus, ToStatus: blockchain.MinedStatus, CreatedAt: now.Add(3 * time.Second)},
+		{Hash: "0x02", ToStatus: blockchain.MinedStatus, CreatedAt: now},
+	}
+	for _, tr := range records {
+		must(t, st.SaveTransition(tr))
+	}
+
+	for _, id := range []string{"r1", "0x01"} {
+		history, err := st.LoadHistory(id)
+		must(t, err)
+		if len(history) != 4 {
+			t.Fatalf("expected 4 records of `%s`, got %d", id, len(history))
+		}
+		for i, tr := range history {
+			if tr.ToStatus != records[i].ToStatus || tr.FromStatus != records[i].FromStatus {
+				t.Errorf("record %d of `%s` is %+v, expected %+v", i, id, tr, records[i])
+			}
+		}
+	}
+
+	history, err := st.LoadHistory("0x03")
+	must(t, err)
+	if len(history) != 0 {
+		t.Errorf("history of unknown transaction is loaded: %v", history)
+	}
+}
+
+func testTx(t *testing.T, st storage.Storage) {
+	committed := newTransaction(t, addrA, addrB, "0x1")
+	must(t, st.WithTx(func(tx storage.Storage) error {
+		saveEntry(t, tx, committed, "0x01", blockchain.BroadcastStatus)
+		return tx.SaveWithdrawTransaction(committed)
+	}))
+	if _, ok, err := st.LoadLastInChain("0x01"); err != nil || !ok {
+		t.Errorf("committed transaction is not loaded: %v, %v", ok, err)
+	}
+
+	errRollback := errors.New("rollback")
+	rolledBack := newTransaction(t, addrA, addrB, "0x2")
+	err := st.WithTx(func(tx storage.Storage) error {
+		saveEntry(t, tx, rolledBack, "0x02", blockchain.BroadcastStatus)
+		must(t, tx.SaveWithdrawTransaction(rolledBack))
+		if exists, err := tx.TransactionExists("0x02"); err != nil || !exists {
+			t.Errorf("transaction is not found inside of its transaction: %v, %v", exists, err)
+		}
+		return errRollback
+	})
+	if err != errRollback {
+		t.Errorf("expected error of fn, got %v", err)
+	}
+
+	exists, err := st.TransactionExists("0x02")
+	must(t, err)
+	if exists {
+		t.Error("entry of rolled back transaction is saved")
+	}
+	if _, ok, err := st.LoadLastInChain("0x02"); err != nil || ok {
+		t.Errorf("withdraw of rolled back transaction is saved: %v, %v", ok, err)
+	}
+	if _, ok, err := st.LoadLastInChain("0x01"); err != nil || !ok {
+		t.Errorf("committed transaction is lost after rollback: %v, %v", ok, err)
+	}
+}
+
+func newTransaction(t *testing.T, from, to, value string) *blockchain.Transaction {
+	tx, err := blockchain.NewTransaction(from, to, value)
+	must(t, err)
+
+	return tx
+}
+
+func minedTransaction(t *testing.T, id int64, hash string, block int64) *blockchain.Transaction {
+	tx := new(blockchain.Transaction)
+	must(t, tx.FillFromDB(&blockchain.DBTransaction{
+		ID:          id,
+		Hash:        hash,
+		BlockHash:   "0xb",
+		BlockNumber: block,
+		From:        addrA,
+		To:          addrB,
+		Amount:      big.NewInt(1),
+		Status:      blockchain.MinedStatus,
+	}))
+
+	return tx
+}
+
+func saveEntry(t *testing.T, st storage.Storage, tx *blockchain.Transaction, hash, status string) {
+	tx.SetHash(hash)
+	tx.SetStatus(status)
+	tx.FixateCreatedAt()
+	must(t, st.SaveEntryTransaction(tx))
+}
+
+func checkBalance(t *testing.T, balances map[string]*big.Int, addr string, expected int64) {
+	bal, ok := balances[addr]
+	if !ok {
+		t.Errorf("balance of `%s` is not loaded", addr)
+	} else if bal.Cmp(big.NewInt(expected)) != 0 {
+		t.Errorf("expected balance %d of `%s`, got %s", expected, addr, bal)
+	}
+}
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
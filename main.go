@@ -1,8 +1,12 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
 
 	"github.com/kainobor/eth-client/app/args"
 	"github.com/kainobor/eth-client/app/blockchain"
@@ -36,19 +40,43 @@ func main() {
 
 	log := logger.New()
 	log.Init(a.Env, c.Logger)
+	log.Infow("Network is chosen", "network", c.Network, "chainID", c.Blockchain.ChainID, "schema", c.Storage.Schema)
 
-	bc := blockchain.New(c.Blockchain)
-	bc.Init()
+	if a.Command == args.CommandMigrate {
+		if err := migrate(c.Storage, a.CommandArgs, log); err != nil {
+			log.Fatalw("error while migrating storage", "error", err)
+		}
+		return
+	}
+
+	// Context is cancelled on shutdown and stops handling and requests in progress
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		<-sig
+		log.Info("Shutting down")
+		cancel()
+	}()
+
+	bc := blockchain.New(c.Blockchain, log)
+	if err := bc.Init(ctx); err != nil {
+		log.Fatalw("error while initiating blockchain client", "error", err)
+	}
 	defer bc.Close()
 
-	st := storage.New(c.Storage)
+	st, err := storage.New(c.Storage)
+	if err != nil {
+		log.Fatalw("error while creating storage", "error", err)
+	}
 	if err := st.Connect(); err != nil {
 		log.Fatalw("error while connecting storage", "config", c.Storage, "error", err)
 	}
 	defer st.Close()
 
 	h := handler.New(c.Handler, bc, st, log)
-	if err := h.Handle(c.Confirmation); err != nil {
+	if err := h.Handle(ctx, c.Confirmation); err != nil {
 		log.Fatalw("error while starting handling", "error", err)
 	}
 
@@ -58,8 +86,51 @@ func main() {
 	srv.RegisterRoutes(ctrl)
 
 	log.Info("Starting server")
-	if err := srv.Start(); err != nil {
+	if err := srv.Start(ctx); err != nil {
 		log.Fatalw("server working failed", "error", err)
 	}
 
 }
+
+// migrate runs command of migrations: up (default) applies new ones, down [steps] reverts the latest ones
+// and status lists all of them
+func migrate(c *config.StorageConfig, cmdArgs []string, log *logger.Logger) error {
+	m, err := storage.NewMigrator(c)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	action := "up"
+	if len(cmdArgs) > 0 {
+		action = cmdArgs[0]
+	}
+
+	switch action {
+	case "up":
+		count, err := m.Up()
+		log.Infow("Migrations are applied", "count", count)
+		return err
+	case "down":
+		steps := 1
+		if len(cmdArgs) > 1 {
+			if steps, err = strconv.Atoi(cmdArgs[1]); err != nil || steps <= 0 {
+				return fmt.Errorf("wrong amount of steps `%s`", cmdArgs[1])
+			}
+		}
+		count, err := m.Down(steps)
+		log.Infow("Migrations are reverted", "count", count)
+		return err
+	case "status":
+		statuses, err := m.Status()
+		if err != nil {
+			return err
+		}
+		for _, st := range statuses {
+			log.Infow("Migration", "version", st.Migration.Version, "name", st.Migration.Name, "applied", st.Applied, "appliedAt", st.AppliedAt)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown action `%s` of migrate command, expected up, down or status", action)
+	}
+}